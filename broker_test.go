@@ -0,0 +1,228 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libmqtt
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is a minimal in process MQTT server for offline client tests,
+// it acknowledges every packet and sends publish packets back to the
+// client when the topic name was subscribed
+type testBroker struct {
+	version  ProtoVersion
+	listener net.Listener
+	recvC    chan Packet // all packets received by broker
+
+	// connAck is used to respond ConnPacket if not nil
+	connAck func() *ConnAckPacket
+
+	mu       *sync.Mutex
+	conns    []net.Conn
+	topics   map[string]bool
+	retained map[string]*PublishPacket
+}
+
+func newTestBroker(t *testing.T, version ProtoVersion) *testBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &testBroker{
+		version:  version,
+		listener: l,
+		recvC:    make(chan Packet, 100),
+		mu:       &sync.Mutex{},
+		topics:   make(map[string]bool),
+		retained: make(map[string]*PublishPacket),
+	}
+	go b.serve()
+	return b
+}
+
+func (b *testBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *testBroker) close() {
+	b.listener.Close()
+	b.mu.Lock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+	b.mu.Unlock()
+}
+
+// disconnect closes all client connections but keeps listening
+func (b *testBroker) disconnect() {
+	b.mu.Lock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+	b.conns = nil
+	b.mu.Unlock()
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		b.mu.Lock()
+		b.conns = append(b.conns, conn)
+		b.mu.Unlock()
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	send := func(pkt Packet) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		pkt.WriteTo(w)
+		w.Flush()
+	}
+
+	for {
+		pkt, err := Decode(b.version, r)
+		if err != nil {
+			return
+		}
+
+		select {
+		case b.recvC <- pkt:
+		default:
+		}
+
+		switch p := pkt.(type) {
+		case *ConnPacket:
+			ack := &ConnAckPacket{}
+			if b.connAck != nil {
+				ack = b.connAck()
+			}
+			ack.ProtoVersion = b.version
+			send(ack)
+		case *SubscribePacket:
+			codes := make([]byte, len(p.Topics))
+			var retained []*PublishPacket
+			b.mu.Lock()
+			for i, t := range p.Topics {
+				codes[i] = t.Qos
+				b.topics[t.Name] = true
+				for name, r := range b.retained {
+					if matchTopic(t.Name, name) {
+						retained = append(retained, r)
+					}
+				}
+			}
+			b.mu.Unlock()
+			send(&SubAckPacket{BasePacket: BasePacket{ProtoVersion: b.version}, PacketID: p.PacketID, Codes: codes})
+			for _, r := range retained {
+				send(r)
+			}
+		case *UnSubPacket:
+			b.mu.Lock()
+			for _, t := range p.TopicNames {
+				delete(b.topics, t)
+			}
+			b.mu.Unlock()
+			send(&UnSubAckPacket{BasePacket: BasePacket{ProtoVersion: b.version}, PacketID: p.PacketID})
+		case *PublishPacket:
+			switch p.Qos {
+			case Qos1:
+				send(&PubAckPacket{BasePacket: BasePacket{ProtoVersion: b.version}, PacketID: p.PacketID})
+			case Qos2:
+				send(&PubRecvPacket{BasePacket: BasePacket{ProtoVersion: b.version}, PacketID: p.PacketID})
+			}
+
+			b.mu.Lock()
+			if p.IsRetain {
+				if len(p.Payload) == 0 {
+					delete(b.retained, p.TopicName)
+				} else {
+					r := *p
+					r.ProtoVersion = b.version
+					r.Qos = Qos0
+					r.PacketID = 0
+					b.retained[p.TopicName] = &r
+				}
+			}
+			subscribed := b.topics[p.TopicName]
+			b.mu.Unlock()
+			if subscribed {
+				echo := *p
+				echo.ProtoVersion = b.version
+				echo.Qos = Qos0
+				echo.PacketID = 0
+				echo.IsRetain = false
+				send(&echo)
+			}
+		case *PubRelPacket:
+			send(&PubCompPacket{BasePacket: BasePacket{ProtoVersion: b.version}, PacketID: p.PacketID})
+		case *DisConnPacket:
+			return
+		default:
+			if pkt == PingReqPacket {
+				send(PingRespPacket)
+			}
+		}
+	}
+}
+
+// waitPacket waits for a packet with type t received by broker
+func (b *testBroker) waitPacket(t *testing.T, typ CtrlType) Packet {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case pkt := <-b.recvC:
+			if pkt.Type() == typ {
+				return pkt
+			}
+		case <-timeout:
+			t.Fatalf("wait for packet type %d timeout", typ)
+			return nil
+		}
+	}
+}
+
+// connectTestClient connects client c and waits for the connection result
+func connectTestClient(t *testing.T, c Client) {
+	connected := make(chan error, 1)
+	c.Connect(func(server string, code byte, err error) {
+		connected <- err
+	})
+
+	select {
+	case err := <-connected:
+		if err != nil {
+			t.Fatal("connect to test broker failed:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connect to test broker timeout")
+	}
+}
@@ -22,7 +22,10 @@ import (
 	"errors"
 	"math"
 	"net"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,7 +37,8 @@ var (
 // Client type for *AsyncClient
 type Client = *AsyncClient
 
-// NewClient create a new mqtt client
+// NewClient create a new mqtt client, servers can also be added
+// later with AddServer
 func NewClient(options ...Option) (Client, error) {
 	c := defaultClient()
 
@@ -45,12 +49,36 @@ func NewClient(options ...Option) (Client, error) {
 		}
 	}
 
-	if (len(c.options.servers) + len(c.options.secureServers)) < 1 {
-		return nil, errors.New("no server provided, won't work ")
+	// register servers with connection options
+	addServers := func(servers []string, secure bool) error {
+		for _, server := range servers {
+			options := c.options
+			if opts, ok := c.options.serverConfigs[server]; ok {
+				var err error
+				if options, err = c.options.override(opts); err != nil {
+					return err
+				}
+			}
+
+			if err := c.addServer(server, secure, options); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := addServers(c.options.servers, false); err != nil {
+		return nil, err
+	}
+	if err := addServers(c.options.secureServers, true); err != nil {
+		return nil, err
 	}
 
 	c.sendCh = make(chan Packet, c.options.sendChanSize)
 	c.recvCh = make(chan *PublishPacket, c.options.recvChanSize)
+	if c.limiter != nil {
+		c.limiter.init(c.options.sendChanSize)
+	}
 
 	return c, nil
 }
@@ -62,17 +90,34 @@ type AsyncClient struct {
 	sendCh  chan Packet         // pub channel for sending publish packet to server
 	recvCh  chan *PublishPacket // recv channel for server pub receiving
 	idGen   *idGenerator        // Packet id generator
+	subs    *subRegistry        // Active subscriptions
+	servers *serverRegistry     // Servers to connect
 	router  TopicRouter         // Topic router
 	persist PersistMethod       // Persist method
+	limiter *rateLimiter        // Rate limiter for outgoing publish packets
+	metrics Metrics             // Metrics of client internals
+	tracer  TracePropagator     // Trace context propagator
+	codec   Codec               // Codec for typed payloads
 	workers *sync.WaitGroup     // Workers (goroutines)
 	log     *logger             // client logger
 
+	compression *Compression // Payload compression
+	connOptions int          // count of connection options applied, see connOption
+
+	inflight   [Qos2 + 1]int32 // count of QoS 1 and QoS 2 publish packets waiting for ack
+	connAck    atomic.Value    // *ConnAckPacket, the latest connack from server
+	dispatcher atomic.Value    // uint64, id of the goroutine dispatching received messages
+
+	retainCollectors *sync.Map  // *retainCollector, retained message snapshots in progress
+	requests         *requester // Pending requests and response topic
+
 	// success/error handlers
-	pubHandler     PubHandler
-	subHandler     SubHandler
-	unSubHandler   UnSubHandler
-	netHandler     NetHandler
-	persistHandler PersistHandler
+	pubHandler      PubHandler
+	subHandler      SubHandler
+	unSubHandler    UnSubHandler
+	netHandler      NetHandler
+	persistHandler  PersistHandler
+	dispatchHandler DispatchHandler
 
 	ctx  context.Context    // closure of this channel will signal all client worker to stop
 	exit context.CancelFunc // called when client exit
@@ -94,42 +139,91 @@ func defaultClient() *AsyncClient {
 			protoVersion:     V311,
 			protoCompromise:  false,
 			defaultTlsConfig: &tls.Config{},
+			dialer:           &net.Dialer{},
+			resolver:         net.DefaultResolver,
 		},
 		msgCh:   make(chan *message, 10),
 		ctx:     ctx,
 		exit:    cancel,
 		router:  NewTextRouter(),
 		idGen:   newIDGenerator(),
+		subs:    newSubRegistry(),
+		servers: newServerRegistry(),
 		workers: &sync.WaitGroup{},
 		persist: NonePersist,
+		metrics: &noneMetrics{},
+		codec:   JSONCodec,
+		log:     &logger{out: newStdLogger(os.Stderr), redact: defaultRedaction},
+
+		retainCollectors: &sync.Map{},
+		requests:         newRequester(),
 	}
 }
 
 // Handle register subscription message route
 func (c *AsyncClient) Handle(topic string, h TopicHandler) {
 	if h != nil {
-		c.log.d("HDL registered topic handler, topic =", topic)
+		c.log.d("HDL registered topic handler", logTopic(topic))
 		c.router.Handle(topic, h)
 	}
 }
 
-// Connect to all designated server
-func (c *AsyncClient) Connect(h ConnHandler) {
-	c.log.d("CLI connect to server, handler =", h)
+// HandlePacket register subscription message route with handler
+// accepting the received publish packet
+//
+// the router MUST support packet handlers with method
+// `HandlePacket(topic string, h PacketHandler)` (all routers in this
+// package do), otherwise the packet passed to h has topic name, qos
+// and payload only
+func (c *AsyncClient) HandlePacket(topic string, h PacketHandler) {
+	if h == nil {
+		return
+	}
 
-	for _, s := range c.options.servers {
-		c.workers.Add(1)
-		go c.connect(s, false, h)
+	if r, ok := c.router.(packetRouter); ok {
+		c.log.d("HDL registered packet handler", logTopic(topic))
+		r.HandlePacket(topic, h)
+		return
+	}
+
+	c.log.w("HDL router does not support packet handler", logTopic(topic), logField("router", c.router.Name()))
+	c.Handle(topic, topicHandler(h))
+}
+
+// HandleContext register subscription message route with handler
+// accepting the context extracted from the received publish packet
+// (see `HandlePacket`)
+func (c *AsyncClient) HandleContext(topic string, h ContextTopicHandler) {
+	if h != nil {
+		c.HandlePacket(topic, func(pkt *PublishPacket) {
+			h(c.extractTrace(pkt), pkt)
+		})
 	}
+}
+
+// Connect to all designated server
+func (c *AsyncClient) Connect(h ConnHandler) {
+	c.log.d("CLI connect to server")
 
-	for _, s := range c.options.secureServers {
+	c.servers.mu.Lock()
+	c.servers.started = true
+	c.servers.handler = h
+	for _, s := range c.servers.servers {
 		c.workers.Add(1)
-		go c.connect(s, true, h)
+		go c.connect(s, h)
 	}
+	c.servers.mu.Unlock()
 
 	c.workers.Add(2)
 	go c.handleTopicMsg()
 	go c.handleMsg()
+
+	if c.limiter != nil {
+		for _, r := range c.limiter.rules {
+			c.workers.Add(1)
+			go c.handlePace(r)
+		}
+	}
 }
 
 // Publish message(s) to topic(s), one to one
@@ -151,22 +245,46 @@ func (c *AsyncClient) Publish(msg ...*PublishPacket) {
 		if p.Qos != Qos0 {
 			if p.PacketID == 0 {
 				p.PacketID = c.idGen.next(p)
+				c.addInflight(p.Qos, 1)
 				if err := c.persist.Store(sendKey(p.PacketID), p); err != nil {
 					notifyPersistMsg(c.msgCh, err)
 				}
 			}
 		}
-		c.sendCh <- p
+
+		if c.limiter != nil {
+			c.pace(p)
+		} else {
+			c.sendCh <- p
+		}
 	}
 }
 
+// PublishContext publish message(s) with the trace context in ctx
+// injected into the user properties by the trace propagator
+// (see `WithTracePropagator`), copies of msg are published with the
+// trace context, msg is not modified
+func (c *AsyncClient) PublishContext(ctx context.Context, msg ...*PublishPacket) {
+	packets := make([]*PublishPacket, 0, len(msg))
+	for _, m := range msg {
+		if m != nil {
+			packets = append(packets, c.injectTrace(ctx, m))
+		}
+	}
+
+	c.Publish(packets...)
+}
+
 // Subscribe topic(s)
+//
+// successful subscriptions are restored automatically when the server
+// starts a new session (ConnAckPacket.Present is false)
 func (c *AsyncClient) Subscribe(topics ...*Topic) {
 	if c.isClosing() {
 		return
 	}
 
-	c.log.d("CLI subscribe, topic(s) =", topics)
+	c.log.d("CLI subscribe", logField("topics", topics))
 
 	s := &SubscribePacket{Topics: topics}
 	s.PacketID = c.idGen.next(s)
@@ -174,13 +292,65 @@ func (c *AsyncClient) Subscribe(topics ...*Topic) {
 	c.sendCh <- s
 }
 
+// SubscribeShared subscribe topic(s) as shared subscriptions of the group,
+// topic names are prefixed with $share/<group>/ and messages are dispatched
+// to handlers registered with either the shared or the plain topic filter
+func (c *AsyncClient) SubscribeShared(group string, topics ...*Topic) {
+	if c.isClosing() {
+		return
+	}
+
+	shared := make([]*Topic, len(topics))
+	for i, t := range topics {
+		name, err := sharedTopic(group, t.Name)
+		if err != nil {
+			c.log.e("CLI invalid shared subscription", logField("group", group), logErr(err))
+			notifySubMsg(c.msgCh, topics, err)
+			return
+		}
+
+		topic := *t
+		topic.Name = name
+		// no local is not allowed for shared subscription
+		topic.NoLocal = false
+		shared[i] = &topic
+	}
+
+	c.Subscribe(shared...)
+}
+
+// SubscribeWithHandler subscribe topic(s) with a new subscription identifier
+// (since MQTT 5) bound to the handler, the identifier is used for dispatch
+// if the router supports it (see SubIDRouter), the topic(s) are registered
+// to router as well for servers without subscription identifier support
+func (c *AsyncClient) SubscribeWithHandler(h TopicHandler, topics ...*Topic) {
+	if c.isClosing() {
+		return
+	}
+
+	subID := c.subs.nextSubID()
+	if r, ok := c.router.(subIDRouter); ok {
+		r.HandleSubID(subID, h)
+	}
+	for _, t := range topics {
+		c.router.Handle(t.Name, h)
+	}
+
+	c.log.d("CLI subscribe", logField("topics", topics), logField("subID", subID))
+
+	s := &SubscribePacket{Topics: topics, Props: &SubscribeProps{SubID: subID}}
+	s.PacketID = c.idGen.next(s)
+
+	c.sendCh <- s
+}
+
 // UnSubscribe topic(s)
 func (c *AsyncClient) UnSubscribe(topics ...string) {
 	if c.isClosing() {
 		return
 	}
 
-	c.log.d("CLI unsubscribe topic(s) =", topics)
+	c.log.d("CLI unsubscribe", logField("topics", topics))
 
 	u := &UnSubPacket{TopicNames: topics}
 	u.PacketID = c.idGen.next(u)
@@ -201,7 +371,7 @@ func (c *AsyncClient) Wait() {
 // Destroy will disconnect form all server
 // If force is true, then close connection without sending a DisConnPacket
 func (c *AsyncClient) Destroy(force bool) {
-	c.log.d("CLI destroying client with force =", force)
+	c.log.d("CLI destroying client", logField("force", force))
 	if force {
 		c.exit()
 	} else {
@@ -239,22 +409,31 @@ func (c *AsyncClient) HandlePersist(h PersistHandler) {
 	c.persistHandler = h
 }
 
+// HandleDispatch register handler for errors of received messages
+// not dispatched to topic handlers
+func (c *AsyncClient) HandleDispatch(h DispatchHandler) {
+	c.log.d("CLI registered dispatch handler")
+	c.dispatchHandler = h
+}
+
+// ThrottleStats returns the counters of outgoing traffic
+// throttled by rate limit (see `WithRateLimit`)
+func (c *AsyncClient) ThrottleStats() ThrottleStats {
+	return c.limiter.stats()
+}
+
 // connect to one server and start mqtt logic
-func (c *AsyncClient) connect(server string, secure bool, h ConnHandler) {
+func (c *AsyncClient) connect(s *serverConn, h ConnHandler) {
 	defer c.workers.Done()
 
 	// Number of failures since the last successful connection.
 	nfail := 0
 
-	for !c.isClosing() {
-		tlsConfig := c.options.tlsConfig
-		if secure {
-			tlsConfig = c.options.defaultTlsConfig
-		}
-
-		if connImpl, err := c.tryConnect(server, tlsConfig); err != nil {
+	server := s.name
+	for !c.isClosing() && !s.isRemoved() {
+		if connImpl, err := c.dial(s); err != nil {
 			nfail++
-			c.log.e("CLI connect failed, err =", err, "server =", server, "failure count =", nfail)
+			c.log.e("CLI connect failed", logServer(server), logErr(err), logField("failures", nfail))
 			if h != nil {
 				code := byte(math.MaxUint8)
 				if conerr, ok := err.(connAckError); ok {
@@ -264,16 +443,28 @@ func (c *AsyncClient) connect(server string, secure bool, h ConnHandler) {
 			}
 		} else {
 			nfail = 0
-			c.log.i("CLI connected to server =", server)
+			c.connAck.Store(connImpl.connAck)
+			c.log.i("CLI connected to server", logServer(server), logField("address", connImpl.name))
 			if h != nil {
 				go h(server, CodeSuccess, nil)
 			}
 
+			// restore subscriptions if server has no session for us
+			if !connImpl.connAck.Present {
+				connImpl.resubscribe()
+			}
+
 			// login success, start mqtt logic
-			connImpl.logic()
+			if s.setConnection(connImpl) {
+				connImpl.logic()
+				s.setConnection(nil)
+			} else {
+				// server removed while connecting
+				connImpl.send(&DisConnPacket{})
+			}
 		}
 
-		if c.isClosing() || !c.options.autoReconnect {
+		if c.isClosing() || s.isRemoved() || !c.options.autoReconnect {
 			return
 		}
 
@@ -285,54 +476,114 @@ func (c *AsyncClient) connect(server string, secure bool, h ConnHandler) {
 				delay = c.options.maxDelay
 			}
 		}
-		c.log.e("CLI reconnecting to server =", server, "delay =", delay)
+		c.log.e("CLI reconnecting to server", logServer(server), logField("delay", delay))
+		c.metrics.Reconnect(server)
 
 		select {
-		case <-c.ctx.Done():
+		case <-s.ctx.Done():
 		case <-time.After(delay):
 		}
 	}
 }
 
-func (c *AsyncClient) tryConnect(server string, tlsConfig *tls.Config) (*clientConn, error) {
-	// Enforce timeout for establishing connection.
-	dialCtx, cancel := context.WithTimeout(c.ctx, c.options.dialTimeout)
-	defer cancel()
+// dial connects to server s, brokers discovered with SRV records
+// are tried in order until connected
+func (c *AsyncClient) dial(s *serverConn) (*clientConn, error) {
+	options := s.options
+	scheme, domain := splitServer(s.name)
+	if scheme != "srv" {
+		tlsConfig := options.tlsConfig
+		if s.secure {
+			tlsConfig = options.defaultTlsConfig
+		}
+		return c.tryConnect(s, s.name, tlsConfig)
+	}
 
-	dialer := net.Dialer{}
-	conn, err := dialer.DialContext(dialCtx, "tcp", server)
+	lookupCtx, cancel := context.WithTimeout(s.ctx, options.dialTimeout)
+	servers, err := lookupSRV(lookupCtx, options.resolver, domain)
+	cancel()
 	if err != nil {
 		return nil, err
 	}
 
-	if tlsConfig != nil {
-		// Perform TLS handshake.
-		tlsConn := tls.Client(conn, tlsConfig)
-		if err := honorContext(dialCtx, c.workers, tlsConn.Handshake); err != nil {
-			conn.Close()
+	for _, server := range servers {
+		var tlsConfig *tls.Config
+		if strings.HasPrefix(server, "tls://") {
+			tlsConfig = options.tlsConfig
+		}
+
+		var connImpl *clientConn
+		if connImpl, err = c.tryConnect(s, server, tlsConfig); err == nil {
+			return connImpl, nil
+		}
+		c.log.e("CLI connect failed", logServer(server), logErr(err))
+	}
+	return nil, err
+}
+
+func (c *AsyncClient) tryConnect(s *serverConn, server string, tlsConfig *tls.Config) (*clientConn, error) {
+	options := s.options
+
+	// Enforce timeout for establishing connection.
+	dialCtx, cancel := context.WithTimeout(s.ctx, options.dialTimeout)
+	defer cancel()
+
+	scheme, address := splitServer(server)
+	transport, ok := c.transport(scheme)
+	if !ok {
+		return nil, ErrUnsupportedScheme
+	}
+
+	if tlsConfig == nil && secureSchemes[scheme] {
+		tlsConfig = options.defaultTlsConfig
+	}
+
+	username, password := options.username, options.password
+	if options.credentials != nil {
+		var err error
+		if username, password, err = options.credentials(dialCtx, server); err != nil {
 			return nil, err
 		}
-		conn = tlsConn
 	}
 
-	connImpl := newClientConn(c.options.protoVersion, c, server, conn)
+	dialer := options.dialer
+	if options.proxy != nil {
+		dialer = NewProxyDialer(options.proxy, dialer)
+	}
+
+	conn, err := transport(dialCtx, dialer, address, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	connImpl := newClientConn(s.ctx, options, c, server, conn)
 
 	c.workers.Add(2)
 	go connImpl.handleSend()
 	go connImpl.handleRecv()
 
+	var props *ConnProps
+	if options.protoVersion == V5 {
+		// response information is used for request/response
+		props = &ConnProps{ReqRespInfo: true}
+	}
+
 	connImpl.send(&ConnPacket{
-		Username:     c.options.username,
-		Password:     c.options.password,
-		ClientID:     c.options.clientID,
-		CleanSession: c.options.cleanSession,
-		IsWill:       c.options.isWill,
-		WillQos:      c.options.willQos,
-		WillTopic:    c.options.willTopic,
-		WillMessage:  c.options.willPayload,
-		WillRetain:   c.options.willRetain,
-		Keepalive:    uint16(c.options.keepalive / time.Second),
+		Username:     username,
+		Password:     password,
+		ClientID:     options.clientID,
+		CleanSession: options.cleanSession,
+		IsWill:       options.isWill,
+		WillQos:      options.willQos,
+		WillTopic:    options.willTopic,
+		WillMessage:  options.willPayload,
+		WillRetain:   options.willRetain,
+		Keepalive:    uint16(options.keepalive / time.Second),
+		Props:        props,
 	})
+	c.log.v("CLI sent connect packet", logServer(server),
+		logField(LogKeyClientID, options.clientID),
+		logField(LogKeyUsername, username))
 
 	if err := connImpl.waitForConnAck(dialCtx); err != nil {
 		connImpl.exit()
@@ -344,6 +595,15 @@ func (c *AsyncClient) tryConnect(server string, tlsConfig *tls.Config) (*clientC
 
 }
 
+// addInflight changes the count of publish packets waiting for ack
+func (c *AsyncClient) addInflight(qos QosLevel, delta int32) {
+	if qos == Qos0 || qos > Qos2 {
+		return
+	}
+
+	c.metrics.Inflight(qos, int(atomic.AddInt32(&c.inflight[qos], delta)))
+}
+
 func (c *AsyncClient) isClosing() bool {
 	select {
 	case <-c.ctx.Done():
@@ -356,6 +616,7 @@ func (c *AsyncClient) isClosing() bool {
 func (c *AsyncClient) handleTopicMsg() {
 	defer c.workers.Done()
 
+	c.dispatcher.Store(goroutineID())
 	for {
 		select {
 		case <-c.ctx.Done():
@@ -365,11 +626,31 @@ func (c *AsyncClient) handleTopicMsg() {
 				return
 			}
 
+			p, err := c.decompress(pkt)
+			if err != nil {
+				c.log.w("CLI decompress payload failed", logTopic(pkt.TopicName), logErr(err))
+				notifyDispatchMsg(c.msgCh, pkt.TopicName, err)
+				continue
+			}
+			pkt = p
+
+			if pkt.IsRetain {
+				c.collectRetained(pkt)
+			}
+
 			c.router.Dispatch(pkt)
+			c.metrics.QueueDepth(len(c.sendCh), len(c.recvCh))
 		}
 	}
 }
 
+// inDispatch reports whether it's called by the goroutine dispatching
+// received messages, e.g. in topic handlers
+func (c *AsyncClient) inDispatch() bool {
+	id, ok := c.dispatcher.Load().(uint64)
+	return ok && id == goroutineID()
+}
+
 func (c *AsyncClient) handleMsg() {
 	defer c.workers.Done()
 
@@ -400,9 +681,14 @@ func (c *AsyncClient) handleMsg() {
 					c.netHandler(m.msg, m.err)
 				}
 			case persistMsg:
+				c.metrics.PersistError(m.err)
 				if c.persistHandler != nil {
 					c.persistHandler(m.err)
 				}
+			case dispatchMsg:
+				if c.dispatchHandler != nil {
+					c.dispatchHandler(m.msg, m.err)
+				}
 			}
 		}
 	}
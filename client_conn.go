@@ -21,34 +21,40 @@ import (
 	"context"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 )
 
 // clientConn is the wrapper of connection to server
 // tend to actual packet send and receive
 type clientConn struct {
+	options      *clientOptions     // connection options of the server
 	protoVersion ProtoVersion       // mqtt protocol version
 	parent       Client             // client which created this connection
 	name         string             // server addr info
 	conn         net.Conn           // connection to server
-	connRW       *bufio.ReadWriter  // make buffered connection
+	connRW       *countingRW        // make buffered connection
 	logicSendC   chan Packet        // logic send channel
 	netRecvC     chan Packet        // received packet from server
 	keepaliveC   chan int           // keepalive packet
+	sentAt       *sync.Map          // send time of packets waiting for ack
+	connAck      *ConnAckPacket     // connack packet received from server
 	ctx          context.Context    // context for single connection
 	exit         context.CancelFunc // terminate this connection if necessary
 }
 
-func newClientConn(protoVersion ProtoVersion, parent *AsyncClient, name string, conn net.Conn) *clientConn {
-	ctx, cancel := context.WithCancel(parent.ctx)
+func newClientConn(ctx context.Context, options *clientOptions, parent *AsyncClient, name string, conn net.Conn) *clientConn {
+	ctx, cancel := context.WithCancel(ctx)
 
 	return &clientConn{
-		protoVersion: protoVersion,
+		options:      options,
+		protoVersion: options.protoVersion,
 		parent:       parent,
 		name:         name,
 		conn:         conn,
-		connRW:       bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+		connRW:       &countingRW{ReadWriter: bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))},
 		keepaliveC:   make(chan int),
+		sentAt:       &sync.Map{},
 		logicSendC:   make(chan Packet),
 		netRecvC:     make(chan Packet),
 		ctx:          ctx,
@@ -60,11 +66,11 @@ func newClientConn(protoVersion ProtoVersion, parent *AsyncClient, name string,
 func (c *clientConn) logic() {
 	defer func() {
 		c.conn.Close()
-		c.parent.log.e("NET exit logic for server =", c.name)
+		c.parent.log.e("NET exit logic", logServer(c.name))
 	}()
 
 	// start keepalive if required
-	if c.parent.options.keepalive > 0 {
+	if c.options.keepalive > 0 {
 		c.parent.workers.Add(1)
 		go c.keepalive()
 	}
@@ -81,7 +87,8 @@ func (c *clientConn) logic() {
 			switch pkt.(type) {
 			case *SubAckPacket:
 				p := pkt.(*SubAckPacket)
-				c.parent.log.v("NET received SubAck, id =", p.PacketID)
+				c.parent.log.v("NET received SubAck", logServer(c.name), logID(p.PacketID))
+				c.acked(CtrlSubAck, p.PacketID)
 
 				if originPkt, ok := c.parent.idGen.getExtra(p.PacketID); ok {
 					switch originPkt.(type) {
@@ -93,7 +100,8 @@ func (c *clientConn) logic() {
 								v.Qos = p.Codes[i]
 							}
 						}
-						c.parent.log.d("NET subscribed topics =", originSub.Topics)
+						c.parent.log.d("NET subscribed topics", logServer(c.name), logField("topics", originSub.Topics))
+						c.parent.subs.subscribed(originSub, p.Codes)
 						notifySubMsg(c.parent.msgCh, originSub.Topics, nil)
 						c.parent.idGen.free(p.PacketID)
 
@@ -102,13 +110,15 @@ func (c *clientConn) logic() {
 				}
 			case *UnSubAckPacket:
 				p := pkt.(*UnSubAckPacket)
-				c.parent.log.v("NET received UnSubAck, id =", p.PacketID)
+				c.parent.log.v("NET received UnSubAck", logServer(c.name), logID(p.PacketID))
+				c.acked(CtrlUnSubAck, p.PacketID)
 
 				if originPkt, ok := c.parent.idGen.getExtra(p.PacketID); ok {
 					switch originPkt.(type) {
 					case *UnSubPacket:
 						originUnSub := originPkt.(*UnSubPacket)
-						c.parent.log.d("NET unSubscribed topics", originUnSub.TopicNames)
+						c.parent.log.d("NET unsubscribed topics", logServer(c.name), logField("topics", originUnSub.TopicNames))
+						c.parent.subs.unSubscribed(originUnSub.TopicNames)
 						notifyUnSubMsg(c.parent.msgCh, originUnSub.TopicNames, nil)
 						c.parent.idGen.free(p.PacketID)
 
@@ -117,35 +127,24 @@ func (c *clientConn) logic() {
 				}
 			case *PublishPacket:
 				p := pkt.(*PublishPacket)
-				c.parent.log.v("NET received publish, topic =", p.TopicName, "id =", p.PacketID, "QoS =", p.Qos)
+				c.parent.log.v("NET received publish", logServer(c.name), logTopic(p.TopicName), logID(p.PacketID), logQos(p.Qos), logPayload(p.Payload))
 				// received server publish, send to client
 				c.parent.recvCh <- p
-
-				// tend to QoS
-				switch p.Qos {
-				case Qos1:
-					c.parent.log.d("NET send PubAck for Publish, id =", p.PacketID)
-					c.send(&PubAckPacket{PacketID: p.PacketID})
-
-					notifyPersistMsg(c.parent.msgCh, c.parent.persist.Store(recvKey(p.PacketID), pkt))
-				case Qos2:
-					c.parent.log.d("NET send PubRecv for Publish, id =", p.PacketID)
-					c.send(&PubRecvPacket{PacketID: p.PacketID})
-
-					notifyPersistMsg(c.parent.msgCh, c.parent.persist.Store(recvKey(p.PacketID), pkt))
-				}
+				c.ackPublish(p)
 			case *PubAckPacket:
 				p := pkt.(*PubAckPacket)
-				c.parent.log.v("NET received PubAck, id =", p.PacketID)
+				c.parent.log.v("NET received PubAck", logServer(c.name), logID(p.PacketID))
 
 				if originPkt, ok := c.parent.idGen.getExtra(p.PacketID); ok {
 					switch originPkt.(type) {
 					case *PublishPacket:
 						originPub := originPkt.(*PublishPacket)
 						if originPub.Qos == Qos1 {
-							c.parent.log.d("NET published qos1 packet, topic =", originPub.TopicName)
+							c.parent.log.d("NET published qos1 packet", logServer(c.name), logTopic(originPub.TopicName), logID(p.PacketID))
+							c.acked(CtrlPubAck, p.PacketID)
 							notifyPubMsg(c.parent.msgCh, originPub.TopicName, nil)
 							c.parent.idGen.free(p.PacketID)
+							c.parent.addInflight(Qos1, -1)
 
 							notifyPersistMsg(c.parent.msgCh, c.parent.persist.Delete(sendKey(p.PacketID)))
 						}
@@ -153,7 +152,7 @@ func (c *clientConn) logic() {
 				}
 			case *PubRecvPacket:
 				p := pkt.(*PubRecvPacket)
-				c.parent.log.v("NET received PubRec, id =", p.PacketID)
+				c.parent.log.v("NET received PubRec", logServer(c.name), logID(p.PacketID))
 
 				if originPkt, ok := c.parent.idGen.getExtra(p.PacketID); ok {
 					switch originPkt.(type) {
@@ -161,13 +160,13 @@ func (c *clientConn) logic() {
 						originPub := originPkt.(*PublishPacket)
 						if originPub.Qos == Qos2 {
 							c.send(&PubRelPacket{PacketID: p.PacketID})
-							c.parent.log.d("NET send PubRel, id =", p.PacketID)
+							c.parent.log.d("NET send PubRel", logServer(c.name), logID(p.PacketID))
 						}
 					}
 				}
 			case *PubRelPacket:
 				p := pkt.(*PubRelPacket)
-				c.parent.log.v("NET send PubRel, id =", p.PacketID)
+				c.parent.log.v("NET received PubRel", logServer(c.name), logID(p.PacketID))
 
 				if originPkt, ok := c.parent.idGen.getExtra(p.PacketID); ok {
 					switch originPkt.(type) {
@@ -175,7 +174,7 @@ func (c *clientConn) logic() {
 						originPub := originPkt.(*PublishPacket)
 						if originPub.Qos == Qos2 {
 							c.send(&PubCompPacket{PacketID: p.PacketID})
-							c.parent.log.d("NET send PubComp, id =", p.PacketID)
+							c.parent.log.d("NET send PubComp", logServer(c.name), logID(p.PacketID))
 
 							notifyPersistMsg(c.parent.msgCh, c.parent.persist.Store(recvKey(p.PacketID), pkt))
 						}
@@ -183,7 +182,7 @@ func (c *clientConn) logic() {
 				}
 			case *PubCompPacket:
 				p := pkt.(*PubCompPacket)
-				c.parent.log.v("NET received PubComp, id =", p.PacketID)
+				c.parent.log.v("NET received PubComp", logServer(c.name), logID(p.PacketID))
 
 				if originPkt, ok := c.parent.idGen.getExtra(p.PacketID); ok {
 					switch originPkt.(type) {
@@ -191,17 +190,19 @@ func (c *clientConn) logic() {
 						originPub := originPkt.(*PublishPacket)
 						if originPub.Qos == Qos2 {
 							c.send(&PubRelPacket{PacketID: p.PacketID})
-							c.parent.log.d("NET send PubRel, id =", p.PacketID)
-							c.parent.log.d("NET published qos2 packet, topic =", originPub.TopicName)
+							c.parent.log.d("NET send PubRel", logServer(c.name), logID(p.PacketID))
+							c.parent.log.d("NET published qos2 packet", logServer(c.name), logTopic(originPub.TopicName), logID(p.PacketID))
+							c.acked(CtrlPubComp, p.PacketID)
 							notifyPubMsg(c.parent.msgCh, originPub.TopicName, nil)
 							c.parent.idGen.free(p.PacketID)
+							c.parent.addInflight(Qos2, -1)
 
 							notifyPersistMsg(c.parent.msgCh, c.parent.persist.Delete(sendKey(p.PacketID)))
 						}
 					}
 				}
 			default:
-				c.parent.log.v("NET received packet, type =", pkt.Type())
+				c.parent.log.v("NET received packet", logServer(c.name), logType(pkt.Type()))
 			}
 		}
 	}
@@ -209,16 +210,16 @@ func (c *clientConn) logic() {
 
 // keepalive with server
 func (c *clientConn) keepalive() {
-	c.parent.log.d("NET start keepalive")
+	c.parent.log.d("NET start keepalive", logServer(c.name))
 
-	t := time.NewTicker(c.parent.options.keepalive * 3 / 4)
-	timeout := time.Duration(float64(c.parent.options.keepalive) * c.parent.options.keepaliveFactor)
+	t := time.NewTicker(c.options.keepalive * 3 / 4)
+	timeout := time.Duration(float64(c.options.keepalive) * c.options.keepaliveFactor)
 	timeoutTimer := time.NewTimer(timeout)
 
 	defer func() {
 		t.Stop()
 		timeoutTimer.Stop()
-		c.parent.log.d("NET stop keepalive for server =", c.name)
+		c.parent.log.d("NET stop keepalive", logServer(c.name))
 		c.parent.workers.Done()
 	}()
 
@@ -239,7 +240,7 @@ func (c *clientConn) keepalive() {
 
 				timeoutTimer.Reset(timeout)
 			case <-timeoutTimer.C:
-				c.parent.log.i("NET keepalive timeout")
+				c.parent.log.i("NET keepalive timeout", logServer(c.name))
 				// exit client connection
 				c.exit()
 				return
@@ -250,11 +251,11 @@ func (c *clientConn) keepalive() {
 
 // handle mqtt logic control packet send
 func (c *clientConn) handleSend() {
-	c.parent.log.v("NET start send handle for server = ", c.name)
+	c.parent.log.v("NET start send handler", logServer(c.name))
 
 	defer func() {
 		c.parent.workers.Done()
-		c.parent.log.e("NET exit send handler for server =", c.name)
+		c.parent.log.e("NET exit send handler", logServer(c.name))
 	}()
 
 	for {
@@ -266,21 +267,39 @@ func (c *clientConn) handleSend() {
 				return
 			}
 
+			c.setVersion(pkt)
+			switch p := pkt.(type) {
+			case *PublishPacket:
+				pkt = c.compress(p)
+			case *SubscribePacket:
+				if p = c.prepareSubscribe(p); p == nil {
+					continue
+				}
+				pkt = p
+			}
+
+			if pkt = c.interceptSend(pkt); pkt == nil {
+				continue
+			}
+
+			c.setVersion(pkt)
 			if err := pkt.WriteTo(c.connRW); err != nil {
-				c.parent.log.e("NET encode error", err)
+				c.parent.log.e("NET encode error", logServer(c.name), logType(pkt.Type()), logErr(err))
 				return
 			}
 
 			if err := c.connRW.Flush(); err != nil {
-				c.parent.log.e("NET flush error", err)
+				c.parent.log.e("NET flush error", logServer(c.name), logErr(err))
 				return
 			}
+			c.sent(pkt)
+			c.parent.metrics.QueueDepth(len(c.parent.sendCh), len(c.parent.recvCh))
 
 			switch pkt.Type() {
 			case CtrlPublish:
 				p := pkt.(*PublishPacket)
 				if p.Qos == 0 {
-					c.parent.log.d("NET published qos0 packet, topic =", p.TopicName)
+					c.parent.log.d("NET published qos0 packet", logServer(c.name), logTopic(p.TopicName))
 					notifyPubMsg(c.parent.msgCh, p.TopicName, nil)
 				}
 			case CtrlDisConn:
@@ -293,15 +312,22 @@ func (c *clientConn) handleSend() {
 				return
 			}
 
+			c.setVersion(pkt)
+			if pkt = c.interceptSend(pkt); pkt == nil {
+				continue
+			}
+
+			c.setVersion(pkt)
 			if err := pkt.WriteTo(c.connRW); err != nil {
-				c.parent.log.e("NET encode error", err)
+				c.parent.log.e("NET encode error", logServer(c.name), logType(pkt.Type()), logErr(err))
 				return
 			}
 
 			if err := c.connRW.Flush(); err != nil {
-				c.parent.log.e("NET flush error", err)
+				c.parent.log.e("NET flush error", logServer(c.name), logErr(err))
 				return
 			}
+			c.sent(pkt)
 
 			switch pkt.Type() {
 			case CtrlPubRel:
@@ -325,7 +351,7 @@ func (c *clientConn) handleSend() {
 // handle all message receive
 func (c *clientConn) handleRecv() {
 	defer func() {
-		c.parent.log.e("NET exit recv handler for server =", c.name)
+		c.parent.log.e("NET exit recv handler", logServer(c.name))
 		close(c.netRecvC)
 		close(c.keepaliveC)
 
@@ -335,7 +361,7 @@ func (c *clientConn) handleRecv() {
 	for {
 		pkt, err := Decode(c.protoVersion, c.connRW)
 		if err != nil {
-			c.parent.log.e("NET connection broken, server =", c.name, "err =", err)
+			c.parent.log.e("NET connection broken", logServer(c.name), logErr(err))
 
 			// TODO send proper net error to net handler
 
@@ -343,9 +369,14 @@ func (c *clientConn) handleRecv() {
 			c.exit()
 			return
 		}
+		c.parent.metrics.PacketRecv(c.name, pkt.Type(), c.connRW.takeRead())
+
+		if pkt = c.interceptRecv(pkt); pkt == nil {
+			continue
+		}
 
 		if pkt == PingRespPacket {
-			c.parent.log.d("NET received keepalive message")
+			c.parent.log.d("NET received keepalive message", logServer(c.name))
 			select {
 			case c.keepaliveC <- 1:
 			case <-c.ctx.Done():
@@ -359,6 +390,58 @@ func (c *clientConn) handleRecv() {
 	}
 }
 
+// setVersion makes the packet encoded with protocol version of the connection
+func (c *clientConn) setVersion(pkt Packet) {
+	if pkt.Type() == CtrlPingReq {
+		// shared instance, same encoding for all versions
+		return
+	}
+
+	if p, ok := pkt.(interface{ setVersion(ProtoVersion) }); ok {
+		p.setVersion(c.protoVersion)
+	}
+}
+
+// sent records the packet written to server
+func (c *clientConn) sent(pkt Packet) {
+	c.parent.metrics.PacketSent(c.name, pkt.Type(), c.connRW.takeWrite())
+
+	switch p := pkt.(type) {
+	case *PublishPacket:
+		if p.Qos > Qos0 {
+			c.sentAt.Store(p.PacketID, time.Now())
+		}
+	case *SubscribePacket:
+		c.sentAt.Store(p.PacketID, time.Now())
+	case *UnSubPacket:
+		c.sentAt.Store(p.PacketID, time.Now())
+	}
+}
+
+// acked reports the ack latency of the packet with id
+func (c *clientConn) acked(t CtrlType, packetID uint16) {
+	if v, ok := c.sentAt.Load(packetID); ok {
+		c.sentAt.Delete(packetID)
+		c.parent.metrics.AckLatency(c.name, t, time.Since(v.(time.Time)))
+	}
+}
+
+// ackPublish tend to QoS of publish packet received
+func (c *clientConn) ackPublish(p *PublishPacket) {
+	switch p.Qos {
+	case Qos1:
+		c.parent.log.d("NET send PubAck for Publish", logServer(c.name), logID(p.PacketID))
+		c.send(&PubAckPacket{PacketID: p.PacketID})
+
+		notifyPersistMsg(c.parent.msgCh, c.parent.persist.Store(recvKey(p.PacketID), p))
+	case Qos2:
+		c.parent.log.d("NET send PubRecv for Publish", logServer(c.name), logID(p.PacketID))
+		c.send(&PubRecvPacket{PacketID: p.PacketID})
+
+		notifyPersistMsg(c.parent.msgCh, c.parent.persist.Store(recvKey(p.PacketID), p))
+	}
+}
+
 // send mqtt logic packet
 func (c *clientConn) send(pkt Packet) {
 	select {
@@ -385,8 +468,9 @@ func (c *clientConn) waitForConnAck(ctx context.Context) error {
 		p := pkt.(*ConnAckPacket)
 		if p.Code != CodeSuccess {
 			return connAckError(p.Code)
-		} else {
-			return nil
 		}
+
+		c.connAck = p
+		return nil
 	}
 }
@@ -153,8 +153,8 @@ func handleTopicAndSub(c Client, t *testing.T) {
 
 func TestNewClient(t *testing.T) {
 	_, err := NewClient()
-	if err == nil {
-		t.Errorf("create new client with no server should fail")
+	if err != nil {
+		t.Errorf("create new client with no server failed: %v", err)
 	}
 
 	_, err = NewClient(
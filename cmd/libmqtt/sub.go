@@ -31,17 +31,12 @@ func execSub(args []string) bool {
 
 	topics := make([]*mqtt.Topic, 0)
 	for _, v := range args {
-		topicStr := strings.Split(v, ",")
-		if len(topicStr) != 2 {
+		topic, ok := parseTopic(v)
+		if !ok {
 			subUsage()
 			return true
 		}
-		qos, err := strconv.Atoi(topicStr[1])
-		if err != nil {
-			subUsage()
-			return true
-		}
-		topics = append(topics, &mqtt.Topic{Name: topicStr[0], Qos: mqtt.QosLevel(qos)})
+		topics = append(topics, topic)
 	}
 	for _, t := range topics {
 		client.Handle(t.Name, topicHandler)
@@ -50,6 +45,38 @@ func execSub(args []string) bool {
 	return true
 }
 
+// parseTopic parses topic,qos[,nl][,rap][,rh=0|1|2]
+func parseTopic(s string) (*mqtt.Topic, bool) {
+	topicStr := strings.Split(s, ",")
+	if len(topicStr) < 2 {
+		return nil, false
+	}
+
+	qos, err := strconv.Atoi(topicStr[1])
+	if err != nil {
+		return nil, false
+	}
+
+	topic := &mqtt.Topic{Name: topicStr[0], Qos: mqtt.QosLevel(qos)}
+	for _, opt := range topicStr[2:] {
+		switch {
+		case opt == "nl":
+			topic.NoLocal = true
+		case opt == "rap":
+			topic.RetainAsPublished = true
+		case strings.HasPrefix(opt, "rh="):
+			rh, err := strconv.Atoi(strings.TrimPrefix(opt, "rh="))
+			if err != nil || rh < mqtt.RetainSendOnSub || rh > mqtt.RetainNoSend {
+				return nil, false
+			}
+			topic.RetainHandling = byte(rh)
+		default:
+			return nil, false
+		}
+	}
+	return topic, true
+}
+
 func execUnSub(args []string) bool {
 	if client == nil {
 		println("please connect to server first")
@@ -61,7 +88,10 @@ func execUnSub(args []string) bool {
 }
 
 func subUsage() {
-	println(`s, sub [topic,qos] [...] - subscribe topic(s)`)
+	println(`s, sub [topic,qos[,nl][,rap][,rh=0|1|2]] [...] - subscribe topic(s)
+	nl   no local (MQTT 5)
+	rap  retain as published (MQTT 5)
+	rh   retain handling (MQTT 5)`)
 }
 
 func unSubUsage() {
@@ -0,0 +1,127 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+var (
+	// ErrContentTypeMismatch is the error when the content type of
+	// received publish packet is not the content type of codec
+	ErrContentTypeMismatch = errors.New("payload content type mismatch ")
+)
+
+// Codec encodes typed values to publish payloads and decodes received payloads
+type Codec interface {
+	// ContentType is the MIME type of encoded payload (e.g. application/json),
+	// used as the content type of MQTT 5 publish packets
+	ContentType() string
+
+	// PayloadFormat is the payload format indicator of MQTT 5 publish
+	// packets, 1 for UTF-8 encoded text, 0 for unspecified bytes
+	PayloadFormat() byte
+
+	// Marshal encodes v to payload
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes payload into v, v is always a pointer
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values with encoding/json, it's the default codec of client
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) PayloadFormat() byte                        { return 1 }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// EncodeValue encodes v with client codec as payload of publish packet,
+// and set content type and payload format for MQTT 5
+func (c *AsyncClient) EncodeValue(p *PublishPacket, v interface{}) error {
+	payload, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if p.Props == nil {
+		p.Props = &PublishProps{}
+	}
+
+	p.Payload = payload
+	p.Props.ContentType = c.codec.ContentType()
+	p.Props.PayloadFormat = c.codec.PayloadFormat()
+	return nil
+}
+
+// PublishValue publish v encoded with client codec to topic (QoS 0),
+// use EncodeValue and Publish for other publish options
+func (c *AsyncClient) PublishValue(topic string, v interface{}) error {
+	p := &PublishPacket{TopicName: topic}
+	if err := c.EncodeValue(p, v); err != nil {
+		return err
+	}
+
+	c.Publish(p)
+	return nil
+}
+
+// HandleValue register subscription message route with handler accepting
+// the payload decoded with client codec
+//
+// v passed to h has the same type of prototype, e.g. for prototype
+// &Foo{}, v is a *Foo, and for prototype Foo{}, v is a Foo
+//
+// the value type is taken from prototype by reflection instead of a type
+// parameter (HandleValue[T]), since generics are unavailable in go 1.16
+//
+// payload with mismatched content type (MQTT 5) or failed to decode is
+// dropped, and the error is sent to DispatchHandler
+func (c *AsyncClient) HandleValue(topic string, prototype interface{}, h ValueHandler) {
+	if h == nil || prototype == nil {
+		return
+	}
+
+	typ := reflect.TypeOf(prototype)
+	isPtr := typ.Kind() == reflect.Ptr
+	if isPtr {
+		typ = typ.Elem()
+	}
+
+	c.HandlePacket(topic, func(pkt *PublishPacket) {
+		if p := pkt.Props; p != nil && p.ContentType != "" && p.ContentType != c.codec.ContentType() {
+			notifyDispatchMsg(c.msgCh, pkt.TopicName, ErrContentTypeMismatch)
+			return
+		}
+
+		v := reflect.New(typ)
+		if err := c.codec.Unmarshal(pkt.Payload, v.Interface()); err != nil {
+			notifyDispatchMsg(c.msgCh, pkt.TopicName, err)
+			return
+		}
+
+		if isPtr {
+			h(pkt.TopicName, v.Interface())
+		} else {
+			h(pkt.TopicName, v.Elem().Interface())
+		}
+	})
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"testing"
+	"time"
+)
+
+type testValue struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestAsyncClient_Value(t *testing.T) {
+	b := newTestBroker(t, V5)
+	defer b.close()
+
+	c, err := NewClient(WithServer(b.addr()), WithVersion(V5, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(chan interface{}, 2)
+	c.HandleValue("value", testValue{}, func(topic string, v interface{}) {
+		values <- v
+	})
+	c.HandleValue("ptr", &testValue{}, func(topic string, v interface{}) {
+		values <- v
+	})
+
+	dispatchErrs := make(chan error, 2)
+	c.HandleDispatch(func(topic string, err error) {
+		dispatchErrs <- err
+	})
+
+	connectTestClient(t, c)
+	c.Subscribe(&Topic{Name: "value"}, &Topic{Name: "ptr"})
+	b.waitPacket(t, CtrlSubscribe)
+
+	if err := c.PublishValue("value", testValue{Name: "foo", Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := b.waitPacket(t, CtrlPublish).(*PublishPacket)
+	if pub.Props.ContentType != "application/json" || pub.Props.PayloadFormat != 1 {
+		t.Errorf("unexpected publish props %+v", pub.Props)
+	}
+
+	c.PublishValue("ptr", &testValue{Name: "bar", Count: 2})
+	for _, target := range []interface{}{testValue{Name: "foo", Count: 1}, &testValue{Name: "bar", Count: 2}} {
+		select {
+		case v := <-values:
+			switch tv := v.(type) {
+			case testValue:
+				if tv != target {
+					t.Errorf("value = %+v, target = %+v", tv, target)
+				}
+			case *testValue:
+				if *tv != *target.(*testValue) {
+					t.Errorf("value = %+v, target = %+v", tv, target)
+				}
+			default:
+				t.Errorf("unexpected value type %T", v)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("value handler not called")
+		}
+	}
+
+	c.Publish(&PublishPacket{TopicName: "value", Payload: []byte("foo"), Props: &PublishProps{ContentType: "text/plain"}})
+	c.Publish(&PublishPacket{TopicName: "value", Payload: []byte("foo")})
+	for _, mismatch := range []bool{true, false} {
+		select {
+		case err := <-dispatchErrs:
+			if (err == ErrContentTypeMismatch) != mismatch {
+				t.Errorf("unexpected dispatch err %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("dispatch handler not called")
+		}
+	}
+
+	c.Destroy(true)
+	c.Wait()
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// CompressAlgorithm is the algorithm to compress publish payload
+type CompressAlgorithm string
+
+// Supported compress algorithms
+const (
+	CompressGzip    CompressAlgorithm = "gzip"
+	CompressDeflate CompressAlgorithm = "deflate"
+)
+
+const (
+	// compressPropKey is the user property key of compress algorithm in MQTT 5
+	compressPropKey = "content-encoding"
+
+	// compressFormatPropKey is the user property key keeping the payload
+	// format indicator of the original payload in MQTT 5
+	compressFormatPropKey = "payload-format"
+
+	defaultMaxDecompressedSize = 16 * 1024 * 1024
+)
+
+var (
+	// ErrDecompressedTooLarge is the error when decompressed payload
+	// exceeds the size limit
+	ErrDecompressedTooLarge = errors.New("decompressed payload too large ")
+
+	// ErrUnsupportedCompression is the error when compress algorithm not supported
+	ErrUnsupportedCompression = errors.New("unsupported compress algorithm ")
+)
+
+// Compression defines how publish payloads are compressed and decompressed
+//
+// compressed payload is marked with user property `content-encoding` in
+// MQTT 5, and with TopicSuffix appended to topic name in MQTT 3.1.1
+//
+// payload format indicator is cleared for compressed payload in MQTT 5,
+// and restored from user property `payload-format` after decompression
+type Compression struct {
+	// Algorithm to compress payload, default is gzip
+	Algorithm CompressAlgorithm
+
+	// Level of compression, see compress/flate, 0 means default level
+	Level int
+
+	// Threshold of payload size, only payload larger than it will be compressed
+	Threshold int
+
+	// TopicSuffix marks compressed payload in MQTT 3.1.1 (e.g. "/gzip"),
+	// no compression in MQTT 3.1.1 if empty
+	TopicSuffix string
+
+	// MaxDecompressedSize limits the size of decompressed payload,
+	// default is 16 MiB
+	MaxDecompressedSize int
+}
+
+func (c *Compression) level() int {
+	if c.Level == 0 {
+		return flate.DefaultCompression
+	}
+	return c.Level
+}
+
+func (c *Compression) maxSize() int {
+	if c.MaxDecompressedSize <= 0 {
+		return defaultMaxDecompressedSize
+	}
+	return c.MaxDecompressedSize
+}
+
+func (c *Compression) compressPayload(algo CompressAlgorithm, payload []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	var w io.WriteCloser
+	var err error
+	switch algo {
+	case CompressGzip:
+		w, err = gzip.NewWriterLevel(buf, c.level())
+	case CompressDeflate:
+		w, err = flate.NewWriter(buf, c.level())
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(payload); err != nil {
+		return nil, err
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *Compression) decompressPayload(algo CompressAlgorithm, payload []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch algo {
+	case CompressGzip:
+		r, err = gzip.NewReader(bytes.NewReader(payload))
+	case CompressDeflate:
+		r = flate.NewReader(bytes.NewReader(payload))
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	max := c.maxSize()
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > max {
+		return nil, ErrDecompressedTooLarge
+	}
+
+	return data, nil
+}
+
+func (c *Compression) algorithm() CompressAlgorithm {
+	if c.Algorithm == "" {
+		return CompressGzip
+	}
+	return c.Algorithm
+}
+
+// compress returns a copy of the publish packet with compressed payload,
+// or the packet itself if no compression required
+func (c *clientConn) compress(p *PublishPacket) *PublishPacket {
+	comp := c.parent.compression
+	if comp == nil || len(p.Payload) <= comp.Threshold {
+		return p
+	}
+
+	if c.protoVersion != V5 && comp.TopicSuffix == "" {
+		return p
+	}
+
+	algo := comp.algorithm()
+	payload, err := comp.compressPayload(algo, p.Payload)
+	if err != nil {
+		c.parent.log.w("NET compress payload failed", logServer(c.name), logTopic(p.TopicName), logErr(err))
+		return p
+	}
+
+	if len(payload) >= len(p.Payload) {
+		return p
+	}
+
+	result := *p
+	result.Payload = payload
+	if c.protoVersion == V5 {
+		props := PublishProps{}
+		if p.Props != nil {
+			props = *p.Props
+		}
+
+		props.UserProps = make(UserProps, len(props.UserProps)+1)
+		for k, v := range p.Props.userProps() {
+			props.UserProps[k] = v
+		}
+		props.UserProps.Set(compressPropKey, string(algo))
+		// compressed payload is never utf-8 text
+		if props.PayloadFormat != 0 {
+			props.UserProps.Set(compressFormatPropKey, strconv.Itoa(int(props.PayloadFormat)))
+			props.PayloadFormat = 0
+		}
+		result.Props = &props
+	} else {
+		result.TopicName += comp.TopicSuffix
+	}
+
+	return &result
+}
+
+// decompress the payload of publish packet received if it was compressed,
+// returns a copy of the packet with decompressed payload
+func (c *AsyncClient) decompress(p *PublishPacket) (*PublishPacket, error) {
+	comp := c.compression
+	if comp == nil {
+		return p, nil
+	}
+
+	if algo := p.Props.userProps().Get(compressPropKey); algo != "" {
+		payload, err := comp.decompressPayload(CompressAlgorithm(algo), p.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		props := *p.Props
+		props.UserProps = make(UserProps, len(p.Props.UserProps))
+		for k, v := range p.Props.UserProps {
+			if k != compressPropKey && k != compressFormatPropKey {
+				props.UserProps[k] = v
+			}
+		}
+
+		if f, err := strconv.Atoi(p.Props.UserProps.Get(compressFormatPropKey)); err == nil {
+			props.PayloadFormat = byte(f)
+		}
+
+		result := *p
+		result.Payload = payload
+		result.Props = &props
+		return &result, nil
+	}
+
+	if comp.TopicSuffix != "" && strings.HasSuffix(p.TopicName, comp.TopicSuffix) {
+		payload, err := comp.decompressPayload(comp.algorithm(), p.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		result := *p
+		result.Payload = payload
+		result.TopicName = strings.TrimSuffix(p.TopicName, comp.TopicSuffix)
+		return &result, nil
+	}
+
+	return p, nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func testCompressRoundTrip(t *testing.T, version ProtoVersion, comp *Compression, subTopic string) *PublishPacket {
+	b := newTestBroker(t, version)
+	defer b.close()
+
+	c, err := NewClient(WithServer(b.addr()), WithVersion(version, false), WithCompression(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan []byte, 1)
+	c.Handle("foo", func(topic string, qos QosLevel, msg []byte) {
+		received <- msg
+	})
+
+	connectTestClient(t, c)
+	c.Subscribe(&Topic{Name: subTopic})
+	b.waitPacket(t, CtrlSubscribe)
+
+	payload := bytes.Repeat([]byte(`{"temperature":20}`), 100)
+	c.Publish(&PublishPacket{TopicName: "foo", Payload: payload})
+	pub := b.waitPacket(t, CtrlPublish).(*PublishPacket)
+	if len(pub.Payload) >= len(payload) {
+		t.Errorf("payload not compressed, size = %d", len(pub.Payload))
+	}
+
+	select {
+	case msg := <-received:
+		if !bytes.Equal(msg, payload) {
+			t.Error("decompressed payload mismatch")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("handler not called")
+	}
+
+	c.Destroy(true)
+	c.Wait()
+	return pub
+}
+
+func TestCompression_V5(t *testing.T) {
+	pub := testCompressRoundTrip(t, V5, &Compression{Threshold: 64}, "foo")
+	if pub.TopicName != "foo" || pub.Props.UserProps.Get(compressPropKey) != string(CompressGzip) {
+		t.Errorf("unexpected compressed packet, topic = %s, props = %+v", pub.TopicName, pub.Props)
+	}
+}
+
+func TestCompression_PayloadFormat(t *testing.T) {
+	c, err := NewClient(WithServer("localhost:1883"), WithCompression(&Compression{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &clientConn{parent: c, protoVersion: V5, name: "localhost:1883"}
+	p := &PublishPacket{
+		TopicName: "foo",
+		Payload:   bytes.Repeat([]byte("text"), 100),
+		Props:     &PublishProps{PayloadFormat: 1, UserProps: UserProps{"foo": {"bar"}}},
+	}
+
+	compressed := conn.compress(p)
+	if compressed.Props.PayloadFormat != 0 || p.Props.PayloadFormat != 1 {
+		t.Errorf("payload format of compressed packet = %d, original = %d", compressed.Props.PayloadFormat, p.Props.PayloadFormat)
+	}
+
+	result, err := c.decompress(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Props.PayloadFormat != 1 || len(result.Props.UserProps) != 1 || result.Props.UserProps.Get("foo") != "bar" {
+		t.Errorf("unexpected decompressed props = %+v", result.Props)
+	}
+}
+
+func TestCompression_V311(t *testing.T) {
+	comp := &Compression{Algorithm: CompressDeflate, TopicSuffix: "/deflate"}
+	if pub := testCompressRoundTrip(t, V311, comp, "foo/deflate"); pub.TopicName != "foo/deflate" {
+		t.Errorf("compressed topic = %s, target = foo/deflate", pub.TopicName)
+	}
+}
+
+func TestCompression_Limit(t *testing.T) {
+	comp := &Compression{MaxDecompressedSize: 100}
+	data, err := comp.compressPayload(CompressGzip, make([]byte, 101))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = comp.decompressPayload(CompressGzip, data); err != ErrDecompressedTooLarge {
+		t.Errorf("decompress err = %v, target = %v", err, ErrDecompressedTooLarge)
+	}
+
+	data, _ = comp.compressPayload(CompressGzip, make([]byte, 100))
+	if result, err := comp.decompressPayload(CompressGzip, data); err != nil || len(result) != 100 {
+		t.Errorf("decompress payload within limit failed, err = %v", err)
+	}
+
+	if _, err = NewClient(WithServer("localhost:1883"), WithCompression(&Compression{Algorithm: "br"})); err != ErrUnsupportedCompression {
+		t.Errorf("unsupported algorithm err = %v", err)
+	}
+}
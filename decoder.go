@@ -237,7 +237,7 @@ func decodeV5Packet(header byte, body []byte) (Packet, error) {
 			Keepalive:    getUint16(next[2:4]),
 			Props:        &ConnProps{},
 		}
-		pkt.ProtoVersion = ProtoVersion(body[0])
+		pkt.ProtoVersion = ProtoVersion(next[0])
 
 		// read properties
 		var props map[byte][]byte
@@ -317,73 +317,58 @@ func decodeV5Packet(header byte, body []byte) (Packet, error) {
 		pub.Payload = body
 		return pub, nil
 	case CtrlPubAck:
-		if len(body) < 3 {
-			return nil, ErrDecodeBadPacket
+		packetID, code, props, err := decodeAckV5(body)
+		if err != nil {
+			return nil, err
 		}
 
 		pkt := &PubAckPacket{
-			PacketID: getUint16(body),
-			Code:     body[2],
+			PacketID: packetID,
+			Code:     code,
 			Props:    &PubAckProps{},
 		}
-
-		props, _, err := getRawProps(body[3:])
-		if err != nil {
-			return nil, err
-		}
 		pkt.Props.setProps(props)
 
 		return pkt, nil
 	case CtrlPubRecv:
-		if len(body) < 3 {
-			return nil, ErrDecodeBadPacket
+		packetID, code, props, err := decodeAckV5(body)
+		if err != nil {
+			return nil, err
 		}
 
 		pkt := &PubRecvPacket{
-			PacketID: getUint16(body),
-			Code:     body[2],
+			PacketID: packetID,
+			Code:     code,
 			Props:    &PubRecvProps{},
 		}
-
-		props, _, err := getRawProps(body[3:])
-		if err != nil {
-			return nil, err
-		}
 		pkt.Props.setProps(props)
 
 		return pkt, nil
 	case CtrlPubRel:
-		if len(body) < 3 {
-			return nil, ErrDecodeBadPacket
+		packetID, code, props, err := decodeAckV5(body)
+		if err != nil {
+			return nil, err
 		}
 
 		pkt := &PubRelPacket{
-			PacketID: getUint16(body),
-			Code:     body[2],
+			PacketID: packetID,
+			Code:     code,
 			Props:    &PubRelProps{},
 		}
-		props, _, err := getRawProps(body[3:])
-		if err != nil {
-			return nil, err
-		}
 		pkt.Props.setProps(props)
 
 		return pkt, nil
 	case CtrlPubComp:
-		if len(body) < 3 {
-			return nil, ErrDecodeBadPacket
+		packetID, code, props, err := decodeAckV5(body)
+		if err != nil {
+			return nil, err
 		}
 
 		pkt := &PubCompPacket{
-			PacketID: getUint16(body),
-			Code:     body[2],
+			PacketID: packetID,
+			Code:     code,
 			Props:    &PubCompProps{},
 		}
-
-		props, _, err := getRawProps(body[3:])
-		if err != nil {
-			return nil, err
-		}
 		pkt.Props.setProps(props)
 
 		return pkt, nil
@@ -405,11 +390,15 @@ func decodeV5Packet(header byte, body []byte) (Packet, error) {
 				return nil, err
 			}
 
-			if len(next) < 1 {
+			// reserved bits of subscription options must be zero,
+			// and retain handling 3 is reserved
+			if len(next) < 1 || next[0]&0xC0 != 0 || next[0]&0x30 == 0x30 {
 				return nil, ErrDecodeBadPacket
 			}
 
-			pkt.Topics = append(pkt.Topics, &Topic{Name: name, Qos: next[0]})
+			topic := &Topic{Name: name}
+			topic.setSubOptions(next[0])
+			pkt.Topics = append(pkt.Topics, topic)
 			next = next[1:]
 		}
 		return pkt, nil
@@ -493,3 +482,23 @@ func decodeV5Packet(header byte, body []byte) (Packet, error) {
 		return nil, ErrDecodeBadPacket
 	}
 }
+
+// decodeAckV5 decodes MQTT 5 acknowledgement packet of publish flow
+// (PubAck, PubRecv, PubRel, PubComp), the reason code and properties
+// are absent when the reason code is success and there are no properties
+func decodeAckV5(body []byte) (uint16, byte, map[byte][]byte, error) {
+	if len(body) < 2 {
+		return 0, 0, nil, ErrDecodeBadPacket
+	}
+
+	if len(body) == 2 {
+		return getUint16(body), CodeSuccess, nil, nil
+	}
+
+	props, _, err := getRawProps(body[3:])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	return getUint16(body), body[2], props, nil
+}
@@ -105,3 +105,28 @@ func BenchmarkDecodeOnePacket(b *testing.B) {
 		}
 	}
 }
+
+func TestDecodeSubOptions(t *testing.T) {
+	pkt := &SubscribePacket{
+		BasePacket: BasePacket{ProtoVersion: V5},
+		PacketID:   testPacketID,
+		Topics:     []*Topic{{Name: "foo", Qos: Qos1}},
+	}
+
+	for opts, valid := range map[byte]bool{
+		0x01: true,
+		0x21: true,
+		0x31: false, // reserved retain handling
+		0x41: false, // reserved bits
+	} {
+		data := pkt.Bytes()
+		data[len(data)-1] = opts
+
+		_, err := Decode(V5, bytes.NewReader(data))
+		if valid && err != nil {
+			t.Errorf("decode subscription options %#x failed, err = %v", opts, err)
+		} else if !valid && err != ErrDecodeBadPacket {
+			t.Errorf("decode subscription options %#x err = %v, target = %v", opts, err, ErrDecodeBadPacket)
+		}
+	}
+}
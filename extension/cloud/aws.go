@@ -0,0 +1,57 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cloud
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// AWSALPN is the ALPN protocol of MQTT with client certificate on port 443
+const AWSALPN = "x-amzn-mqtt-ca"
+
+// AWSIoTCore returns options to connect to AWS IoT Core endpoint (e.g.
+// `xxx-ats.iot.us-east-1.amazonaws.com`) with X.509 client certificate,
+// endpoint without port is connected on port 443 with ALPN AWSALPN,
+// roots nil to use the system root CAs
+func AWSIoTCore(endpoint, clientID string, cert tls.Certificate, roots *x509.CertPool) []mqtt.Option {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		host, port = endpoint, "443"
+	}
+
+	return []mqtt.Option{
+		mqtt.WithServer("tls://" + net.JoinHostPort(host, port)),
+		mqtt.WithCustomTLS(awsTLSConfig(host, port, cert, roots)),
+		mqtt.WithClientID(clientID),
+	}
+}
+
+// awsTLSConfig creates tls config for AWS IoT Core endpoint
+func awsTLSConfig(host, port string, cert tls.Certificate, roots *x509.CertPool) *tls.Config {
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		ServerName:   host,
+	}
+	if port == "443" {
+		config.NextProtos = []string{AWSALPN}
+	}
+	return config
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cloud
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// newTestCert creates self signed certificate for localhost
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, roots
+}
+
+func TestAWSTLSConfig(t *testing.T) {
+	cert, roots := newTestCert(t)
+
+	if config := awsTLSConfig("localhost", "8883", cert, roots); len(config.NextProtos) != 0 {
+		t.Errorf("ALPN %v set on port 8883", config.NextProtos)
+	}
+
+	config := awsTLSConfig("localhost", "443", cert, roots)
+	if len(config.NextProtos) != 1 || config.NextProtos[0] != AWSALPN {
+		t.Fatalf("ALPN = %v, want [%s]", config.NextProtos, AWSALPN)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    roots,
+		NextProtos:   []string{AWSALPN},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	result := make(chan tls.ConnectionState, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			t.Error("handshake failed:", err)
+		}
+		result <- tlsConn.ConnectionState()
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case state := <-result:
+		if state.NegotiatedProtocol != AWSALPN {
+			t.Errorf("negotiated protocol = %q, want %q", state.NegotiatedProtocol, AWSALPN)
+		}
+		if state.ServerName != "localhost" {
+			t.Errorf("server name = %q, want localhost", state.ServerName)
+		}
+		if len(state.PeerCertificates) != 1 {
+			t.Error("client certificate not sent")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake timeout")
+	}
+}
+
+func TestAWSIoTCore(t *testing.T) {
+	cert, roots := newTestCert(t)
+
+	for endpoint, server := range map[string]string{
+		"xxx-ats.iot.us-east-1.amazonaws.com":      "tls://xxx-ats.iot.us-east-1.amazonaws.com:443",
+		"xxx-ats.iot.us-east-1.amazonaws.com:8883": "tls://xxx-ats.iot.us-east-1.amazonaws.com:8883",
+	} {
+		c, err := mqtt.NewClient(AWSIoTCore(endpoint, "thing1", cert, roots)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if servers := c.Servers(); len(servers) != 1 || servers[0] != server {
+			t.Errorf("servers = %v, want [%s]", servers, server)
+		}
+		c.Destroy(true)
+	}
+}
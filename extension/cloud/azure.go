@@ -0,0 +1,79 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cloud
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// AzureAPIVersion is the IoT Hub api version in username
+const AzureAPIVersion = "2021-04-12"
+
+// AzureSASToken generates shared access signature token of resourceURI
+// expires at expiry, key is base64 encoded, policy is the shared access
+// policy name, empty for device keys
+func AzureSASToken(resourceURI, key, policy string, expiry time.Time) (string, error) {
+	k, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", err
+	}
+
+	sr := url.QueryEscape(resourceURI)
+	se := strconv.FormatInt(expiry.Unix(), 10)
+
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte(sr + "\n" + se))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	token := "SharedAccessSignature sr=" + sr + "&sig=" + url.QueryEscape(sig) + "&se=" + se
+	if policy != "" {
+		token += "&skn=" + url.QueryEscape(policy)
+	}
+	return token, nil
+}
+
+// AzureSASProvider provides credentials of device in IoT Hub with SAS
+// token valid for ttl, key is the base64 encoded device key
+func AzureSASProvider(hub, deviceID, key string, ttl time.Duration) mqtt.CredentialsProvider {
+	username := hub + "/" + deviceID + "/?api-version=" + AzureAPIVersion
+	resourceURI := hub + "/devices/" + deviceID
+	return func(ctx context.Context, server string) (string, string, error) {
+		token, err := AzureSASToken(resourceURI, key, "", now().Add(ttl))
+		if err != nil {
+			return "", "", err
+		}
+		return username, token, nil
+	}
+}
+
+// AzureIoTHub returns options to connect to IoT Hub (e.g.
+// `myhub.azure-devices.net`) as device with SAS token valid for ttl
+func AzureIoTHub(hub, deviceID, key string, ttl time.Duration) []mqtt.Option {
+	return []mqtt.Option{
+		mqtt.WithSecureServer(net.JoinHostPort(hub, "8883")),
+		mqtt.WithClientID(deviceID),
+		mqtt.WithCredentialsProvider(AzureSASProvider(hub, deviceID, key, ttl)),
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cloud
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+const (
+	testAzureHub = "myhub.azure-devices.net"
+	testAzureKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+)
+
+func TestAzureSASToken(t *testing.T) {
+	expiry := time.Unix(1700000000, 0)
+	token, err := AzureSASToken(testAzureHub+"/devices/device1", testAzureKey, "", expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "SharedAccessSignature sr=myhub.azure-devices.net%2Fdevices%2Fdevice1" +
+		"&sig=DiOcLA0WkatmUGpn5KPGuDWDJ9sARBqXkXWqy8Ow0QI%3D&se=1700000000"
+	if token != expected {
+		t.Errorf("token = %q, want %q", token, expected)
+	}
+
+	token, err = AzureSASToken(testAzureHub+"/devices/device1", testAzureKey, "iothubowner", expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != expected+"&skn=iothubowner" {
+		t.Errorf("token with policy = %q", token)
+	}
+
+	if _, err := AzureSASToken(testAzureHub, "not base64!", "", expiry); err == nil {
+		t.Error("bad key accepted")
+	}
+}
+
+func TestAzureSASProvider(t *testing.T) {
+	now = func() time.Time { return time.Unix(1699996400, 0) }
+	defer func() { now = time.Now }()
+
+	p := AzureSASProvider(testAzureHub, "device1", testAzureKey, time.Hour)
+	username, password, err := p(context.Background(), testAzureHub+":8883")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if username != "myhub.azure-devices.net/device1/?api-version="+AzureAPIVersion {
+		t.Errorf("username = %q", username)
+	}
+	if password != "SharedAccessSignature sr=myhub.azure-devices.net%2Fdevices%2Fdevice1"+
+		"&sig=DiOcLA0WkatmUGpn5KPGuDWDJ9sARBqXkXWqy8Ow0QI%3D&se=1700000000" {
+		t.Errorf("password = %q", password)
+	}
+
+	c, err := mqtt.NewClient(AzureIoTHub(testAzureHub, "device1", testAzureKey, time.Hour)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy(true)
+
+	if servers := c.Servers(); len(servers) != 1 || servers[0] != testAzureHub+":8883" {
+		t.Errorf("servers = %v", servers)
+	}
+}
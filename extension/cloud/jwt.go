@@ -0,0 +1,128 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cloud
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"time"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+var (
+	// ErrUnsupportedKey is the error when signing JWT with key neither
+	// RSA nor ECDSA P-256
+	ErrUnsupportedKey = errors.New("unsupported JWT signing key ")
+)
+
+// GoogleServer is the MQTT bridge server of Google style brokers
+const GoogleServer = "mqtt.googleapis.com"
+
+// jwtClaims are claims required by Google style brokers
+type jwtClaims struct {
+	IssuedAt int64  `json:"iat"`
+	Expiry   int64  `json:"exp"`
+	Audience string `json:"aud"`
+}
+
+// SignJWT creates JWT for audience signed with key, RS256 for RSA keys,
+// ES256 for ECDSA P-256 keys
+func SignJWT(key crypto.Signer, audience string, issuedAt, expiry time.Time) (string, error) {
+	var alg string
+	switch k := key.Public().(type) {
+	case *rsa.PublicKey:
+		alg = "RS256"
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", ErrUnsupportedKey
+		}
+		alg = "ES256"
+	default:
+		return "", ErrUnsupportedKey
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(&jwtClaims{
+		IssuedAt: issuedAt.Unix(),
+		Expiry:   expiry.Unix(),
+		Audience: audience,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	input := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	if alg == "ES256" {
+		// JWS uses r || s instead of ASN.1 signature
+		var rs struct{ R, S *big.Int }
+		if _, err = asn1.Unmarshal(sig, &rs); err != nil {
+			return "", err
+		}
+
+		sig = make([]byte, 64)
+		rs.R.FillBytes(sig[:32])
+		rs.S.FillBytes(sig[32:])
+	}
+
+	return input + "." + enc.EncodeToString(sig), nil
+}
+
+// JWTProvider provides credentials with JWT for audience valid for ttl
+// as password, username is ignored by Google style brokers
+func JWTProvider(audience string, key crypto.Signer, ttl time.Duration) mqtt.CredentialsProvider {
+	return func(ctx context.Context, server string) (string, string, error) {
+		iat := now()
+		token, err := SignJWT(key, audience, iat, iat.Add(ttl))
+		if err != nil {
+			return "", "", err
+		}
+		return "unused", token, nil
+	}
+}
+
+// GoogleIoTCore returns options to connect to Google style broker as
+// device with JWT signed by device key valid for ttl (24h at most)
+func GoogleIoTCore(projectID, region, registryID, deviceID string, key crypto.Signer, ttl time.Duration) []mqtt.Option {
+	return []mqtt.Option{
+		mqtt.WithSecureServer(net.JoinHostPort(GoogleServer, "8883")),
+		mqtt.WithClientID("projects/" + projectID + "/locations/" + region +
+			"/registries/" + registryID + "/devices/" + deviceID),
+		mqtt.WithCredentialsProvider(JWTProvider(projectID, key, ttl)),
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/ugorji/go/codec"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// ErrNotProtoMessage is the error when value encoded or decoded
+// by ProtobufCodec is not a proto.Message
+var ErrNotProtoMessage = errors.New("value is not a proto.Message ")
+
+var (
+	// ProtobufCodec encodes proto.Message values in Protocol Buffers
+	ProtobufCodec mqtt.Codec = protobufCodec{}
+
+	// CBORCodec encodes values in CBOR (RFC 7049)
+	CBORCodec mqtt.Codec = &ugorjiCodec{contentType: "application/cbor", handle: &codec.CborHandle{}}
+
+	// MsgpackCodec encodes values in MessagePack
+	MsgpackCodec mqtt.Codec = &ugorjiCodec{contentType: "application/msgpack", handle: &codec.MsgpackHandle{}}
+)
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+func (protobufCodec) PayloadFormat() byte { return 0 }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
+
+type ugorjiCodec struct {
+	contentType string
+	handle      codec.Handle
+}
+
+func (u *ugorjiCodec) ContentType() string { return u.contentType }
+func (u *ugorjiCodec) PayloadFormat() byte { return 0 }
+
+func (u *ugorjiCodec) Marshal(v interface{}) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, u.handle).Encode(v)
+	return data, err
+}
+
+func (u *ugorjiCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, u.handle).Decode(v)
+}
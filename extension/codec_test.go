@@ -0,0 +1,71 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+type testCodecValue struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func TestCodecs(t *testing.T) {
+	value := &testCodecValue{Name: "foo", Count: 1, Tags: []string{"a", "b"}}
+	for _, c := range []mqtt.Codec{CBORCodec, MsgpackCodec, mqtt.JSONCodec} {
+		data, err := c.Marshal(value)
+		if err != nil {
+			t.Fatalf("%s marshal failed: %v", c.ContentType(), err)
+		}
+
+		decoded := &testCodecValue{}
+		if err = c.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("%s unmarshal failed: %v", c.ContentType(), err)
+		}
+
+		if !reflect.DeepEqual(value, decoded) {
+			t.Errorf("%s decoded = %+v, target = %+v", c.ContentType(), decoded, value)
+		}
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	value := &timestamp.Timestamp{Seconds: 1, Nanos: 2}
+	data, err := ProtobufCodec.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &timestamp.Timestamp{}
+	if err = ProtobufCodec.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Seconds != 1 || decoded.Nanos != 2 {
+		t.Errorf("decoded = %v, target = %v", decoded, value)
+	}
+
+	if _, err = ProtobufCodec.Marshal(struct{}{}); err != ErrNotProtoMessage {
+		t.Errorf("marshal none proto message err = %v", err)
+	}
+}
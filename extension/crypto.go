@@ -0,0 +1,383 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// Cipher is the AEAD algorithm to encrypt payloads
+type Cipher byte
+
+// Supported ciphers
+const (
+	// AESGCM is AES in Galois/Counter Mode, key size is 16, 24 or 32 bytes
+	AESGCM Cipher = iota + 1
+	// ChaCha20Poly1305 is ChaCha20-Poly1305 (RFC 8439), key size is 32 bytes
+	ChaCha20Poly1305
+)
+
+var cipherNames = map[Cipher]string{
+	AESGCM:           "aes-gcm",
+	ChaCha20Poly1305: "chacha20-poly1305",
+}
+
+// EncryptMode defines how encryption metadata is carried
+type EncryptMode byte
+
+const (
+	// EncryptEnvelope prepends a small header with cipher,
+	// key id and nonce to the payload, works with all protocol versions
+	EncryptEnvelope EncryptMode = iota
+	// EncryptUserProps carries cipher, key id and nonce in user properties,
+	// payloads sent with MQTT 3.1.1 are still encrypted with envelope
+	EncryptUserProps
+)
+
+// user property keys of encryption metadata
+const (
+	encPropCipher = "enc-cipher"
+	encPropKeyID  = "enc-kid"
+	encPropNonce  = "enc-nonce"
+)
+
+// envelope header magic and version
+const (
+	envelopeMagic   = 0xE5
+	envelopeVersion = 0x01
+)
+
+var (
+	// ErrKeyNotFound is the error when no key found for the key id
+	ErrKeyNotFound = errors.New("encryption key not found ")
+
+	// ErrNotEncrypted is the error when received payload was not encrypted
+	ErrNotEncrypted = errors.New("payload not encrypted ")
+
+	// ErrBadEnvelope is the error when encrypted payload is malformed
+	ErrBadEnvelope = errors.New("malformed encrypted payload ")
+
+	// ErrUnsupportedCipher is the error when cipher not supported
+	ErrUnsupportedCipher = errors.New("unsupported cipher ")
+)
+
+// KeyProvider provides keys to encrypt and decrypt payloads
+type KeyProvider interface {
+	// CurrentKey returns key id and key to encrypt payloads of topic
+	CurrentKey(topic string) (keyID string, key []byte, err error)
+
+	// Key returns key of key id to decrypt payloads of topic
+	Key(topic, keyID string) ([]byte, error)
+}
+
+// NewKeyRing creates an empty KeyRing
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		mu:   &sync.RWMutex{},
+		keys: make(map[string][]byte),
+	}
+}
+
+// KeyRing is a KeyProvider supports key rotation and per topic keys
+//
+// old keys should be kept after rotation until all payloads encrypted
+// with them were consumed
+type KeyRing struct {
+	mu        *sync.RWMutex
+	keys      map[string][]byte
+	current   string
+	topicKeys []topicKey
+}
+
+type topicKey struct {
+	prefix string
+	keyID  string
+}
+
+// Add key with key id, replaces the existing key with the same id
+func (k *KeyRing) Add(keyID string, key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[keyID] = key
+}
+
+// Remove key with key id, payloads encrypted with it can not be decrypted
+func (k *KeyRing) Remove(keyID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.keys, keyID)
+}
+
+// Rotate makes the key with key id the current key for encryption
+func (k *KeyRing) Rotate(keyID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[keyID]; !ok {
+		return ErrKeyNotFound
+	}
+
+	k.current = keyID
+	return nil
+}
+
+// SetTopicKey makes the key with key id the current key for topics
+// with the prefix, the longest prefix takes precedence
+func (k *KeyRing) SetTopicKey(topicPrefix, keyID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[keyID]; !ok {
+		return ErrKeyNotFound
+	}
+
+	for i, t := range k.topicKeys {
+		if t.prefix == topicPrefix {
+			k.topicKeys[i].keyID = keyID
+			return nil
+		}
+	}
+
+	k.topicKeys = append(k.topicKeys, topicKey{prefix: topicPrefix, keyID: keyID})
+	return nil
+}
+
+// CurrentKey implements KeyProvider
+func (k *KeyRing) CurrentKey(topic string) (string, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keyID, matched := k.current, -1
+	for _, t := range k.topicKeys {
+		if strings.HasPrefix(topic, t.prefix) && len(t.prefix) > matched {
+			keyID, matched = t.keyID, len(t.prefix)
+		}
+	}
+
+	key, ok := k.keys[keyID]
+	if !ok {
+		return "", nil, ErrKeyNotFound
+	}
+
+	return keyID, key, nil
+}
+
+// Key implements KeyProvider
+func (k *KeyRing) Key(topic, keyID string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// NewPayloadEncryption creates PayloadEncryption encrypts payloads with
+// keys from provider
+func NewPayloadEncryption(c Cipher, mode EncryptMode, keys KeyProvider) *PayloadEncryption {
+	return &PayloadEncryption{cipher: c, mode: mode, keys: keys}
+}
+
+// PayloadEncryption encrypts publish payloads end-to-end, the topic name
+// is authenticated with the payload, so encrypted payloads can not be
+// replayed to other topics
+//
+// use it as interceptors of client
+//
+//	mqtt.WithSendInterceptor(enc.Encrypt),
+//	mqtt.WithRecvInterceptor(enc.Decrypt),
+type PayloadEncryption struct {
+	cipher Cipher
+	mode   EncryptMode
+	keys   KeyProvider
+}
+
+// Encrypt is the send interceptor encrypts payload of publish packets
+func (e *PayloadEncryption) Encrypt(server string, pkt mqtt.Packet) (mqtt.Packet, error) {
+	p, ok := pkt.(*mqtt.PublishPacket)
+	if !ok {
+		return pkt, nil
+	}
+
+	keyID, key, err := e.keys.CurrentKey(p.TopicName)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(e.cipher, key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	result := *p
+	if e.mode == EncryptUserProps && p.ProtoVersion == mqtt.V5 {
+		result.Payload = aead.Seal(nil, nonce, p.Payload, []byte(p.TopicName))
+		result.Props = copyPublishProps(p.Props)
+		result.Props.UserProps.Set(encPropCipher, cipherNames[e.cipher])
+		result.Props.UserProps.Set(encPropKeyID, keyID)
+		result.Props.UserProps.Set(encPropNonce, base64.StdEncoding.EncodeToString(nonce))
+		return &result, nil
+	}
+
+	if len(keyID) > 255 {
+		return nil, ErrBadEnvelope
+	}
+
+	// | magic | version | cipher | key id length | key id | nonce | ciphertext |
+	header := make([]byte, 0, 4+len(keyID)+len(nonce))
+	header = append(header, envelopeMagic, envelopeVersion, byte(e.cipher), byte(len(keyID)))
+	header = append(header, keyID...)
+	header = append(header, nonce...)
+	result.Payload = aead.Seal(header, nonce, p.Payload, []byte(p.TopicName))
+	return &result, nil
+}
+
+// Decrypt is the recv interceptor decrypts payload of publish packets,
+// publish packets not encrypted are dropped with ErrNotEncrypted
+func (e *PayloadEncryption) Decrypt(server string, pkt mqtt.Packet) (mqtt.Packet, error) {
+	p, ok := pkt.(*mqtt.PublishPacket)
+	if !ok {
+		return pkt, nil
+	}
+
+	var c Cipher
+	var keyID string
+	var nonce, ciphertext []byte
+	result := *p
+
+	if p.Props != nil && p.Props.UserProps.Get(encPropKeyID) != "" {
+		props := p.Props.UserProps
+		for k, name := range cipherNames {
+			if name == props.Get(encPropCipher) {
+				c = k
+			}
+		}
+
+		var err error
+		if nonce, err = base64.StdEncoding.DecodeString(props.Get(encPropNonce)); err != nil {
+			return nil, ErrBadEnvelope
+		}
+
+		keyID, ciphertext = props.Get(encPropKeyID), p.Payload
+		result.Props = copyPublishProps(p.Props)
+		result.Props.UserProps.Del(encPropCipher)
+		result.Props.UserProps.Del(encPropKeyID)
+		result.Props.UserProps.Del(encPropNonce)
+	} else {
+		data := p.Payload
+		if len(data) < 4 || data[0] != envelopeMagic {
+			return nil, ErrNotEncrypted
+		}
+
+		if data[1] != envelopeVersion || len(data) < 4+int(data[3]) {
+			return nil, ErrBadEnvelope
+		}
+
+		c, keyID, data = Cipher(data[2]), string(data[4:4+int(data[3])]), data[4+int(data[3]):]
+		nonceSize, err := nonceSize(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) < nonceSize {
+			return nil, ErrBadEnvelope
+		}
+		nonce, ciphertext = data[:nonceSize], data[nonceSize:]
+	}
+
+	key, err := e.keys.Key(p.TopicName, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(c, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrBadEnvelope
+	}
+
+	if result.Payload, err = aead.Open(nil, nonce, ciphertext, []byte(p.TopicName)); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func newAEAD(c Cipher, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case AESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, ErrUnsupportedCipher
+	}
+}
+
+func nonceSize(c Cipher) (int, error) {
+	switch c {
+	case AESGCM:
+		return 12, nil
+	case ChaCha20Poly1305:
+		return chacha20poly1305.NonceSize, nil
+	default:
+		return 0, ErrUnsupportedCipher
+	}
+}
+
+// copyPublishProps returns a copy of props with user properties copied
+func copyPublishProps(props *mqtt.PublishProps) *mqtt.PublishProps {
+	result := &mqtt.PublishProps{}
+	if props != nil {
+		*result = *props
+	}
+
+	result.UserProps = make(mqtt.UserProps)
+	if props != nil {
+		for k, v := range props.UserProps {
+			result.UserProps[k] = append([]string(nil), v...)
+		}
+	}
+
+	return result
+}
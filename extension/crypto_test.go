@@ -0,0 +1,135 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"bytes"
+	"testing"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+func newTestKeyRing(t *testing.T, ids ...string) *KeyRing {
+	k := NewKeyRing()
+	for i, id := range ids {
+		k.Add(id, bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+
+	if err := k.Rotate(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func testEncryptPacket(version mqtt.ProtoVersion, topic, payload string) *mqtt.PublishPacket {
+	return &mqtt.PublishPacket{
+		BasePacket: mqtt.BasePacket{ProtoVersion: version},
+		TopicName:  topic,
+		Payload:    []byte(payload),
+	}
+}
+
+func TestPayloadEncryption_RoundTrip(t *testing.T) {
+	for _, c := range []Cipher{AESGCM, ChaCha20Poly1305} {
+		for _, mode := range []EncryptMode{EncryptEnvelope, EncryptUserProps} {
+			for _, version := range []mqtt.ProtoVersion{mqtt.V311, mqtt.V5} {
+				enc := NewPayloadEncryption(c, mode, newTestKeyRing(t, "k1"))
+				origin := testEncryptPacket(version, "foo", "secret")
+
+				pkt, err := enc.Encrypt("", origin)
+				if err != nil {
+					t.Fatalf("cipher %d mode %d encrypt failed: %v", c, mode, err)
+				}
+
+				encrypted := pkt.(*mqtt.PublishPacket)
+				if bytes.Contains(encrypted.Payload, origin.Payload) || string(origin.Payload) != "secret" {
+					t.Errorf("cipher %d mode %d payload not encrypted or origin modified", c, mode)
+				}
+
+				hasProps := encrypted.Props != nil && encrypted.Props.UserProps.Get(encPropKeyID) == "k1"
+				if hasProps != (mode == EncryptUserProps && version == mqtt.V5) {
+					t.Errorf("cipher %d mode %d version %d unexpected props %+v", c, mode, version, encrypted.Props)
+				}
+
+				pkt, err = enc.Decrypt("", encrypted)
+				if err != nil {
+					t.Fatalf("cipher %d mode %d decrypt failed: %v", c, mode, err)
+				}
+
+				decrypted := pkt.(*mqtt.PublishPacket)
+				if string(decrypted.Payload) != "secret" {
+					t.Errorf("cipher %d mode %d decrypted = %q", c, mode, decrypted.Payload)
+				}
+
+				if decrypted.Props != nil && len(decrypted.Props.UserProps) != 0 {
+					t.Errorf("encryption props not removed %+v", decrypted.Props.UserProps)
+				}
+			}
+		}
+	}
+}
+
+func TestPayloadEncryption_Rotation(t *testing.T) {
+	keys := newTestKeyRing(t, "k1", "k2", "k3")
+	enc := NewPayloadEncryption(AESGCM, EncryptEnvelope, keys)
+
+	old, _ := enc.Encrypt("", testEncryptPacket(mqtt.V311, "foo", "old"))
+	keys.Rotate("k2")
+	keys.SetTopicKey("secure/", "k3")
+
+	for topic, keyID := range map[string]string{"foo": "k2", "secure/bar": "k3"} {
+		if id, _, err := keys.CurrentKey(topic); err != nil || id != keyID {
+			t.Errorf("key of topic %s = %s, target = %s", topic, id, keyID)
+		}
+	}
+
+	if p, err := enc.Decrypt("", old); err != nil || string(p.(*mqtt.PublishPacket).Payload) != "old" {
+		t.Errorf("payload encrypted with old key not decrypted, err = %v", err)
+	}
+
+	keys.Remove("k1")
+	if _, err := enc.Decrypt("", old); err != ErrKeyNotFound {
+		t.Errorf("decrypt with removed key err = %v", err)
+	}
+}
+
+func TestPayloadEncryption_Reject(t *testing.T) {
+	enc := NewPayloadEncryption(ChaCha20Poly1305, EncryptEnvelope, newTestKeyRing(t, "k1"))
+
+	if _, err := enc.Decrypt("", testEncryptPacket(mqtt.V311, "foo", "plain")); err != ErrNotEncrypted {
+		t.Errorf("plaintext payload err = %v", err)
+	}
+
+	pkt, _ := enc.Encrypt("", testEncryptPacket(mqtt.V311, "foo", "secret"))
+	encrypted := pkt.(*mqtt.PublishPacket)
+
+	replayed := *encrypted
+	replayed.TopicName = "bar"
+	if _, err := enc.Decrypt("", &replayed); err == nil {
+		t.Error("payload replayed to other topic should be rejected")
+	}
+
+	tampered := *encrypted
+	tampered.Payload = append([]byte(nil), encrypted.Payload...)
+	tampered.Payload[len(tampered.Payload)-1] ^= 0xff
+	if _, err := enc.Decrypt("", &tampered); err == nil {
+		t.Error("tampered payload should be rejected")
+	}
+
+	if p, err := enc.Encrypt("", mqtt.PingReqPacket); err != nil || p != mqtt.PingReqPacket {
+		t.Error("none publish packet should pass through")
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"github.com/sirupsen/logrus"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// NewLogrusLogger creates a mqtt.Logger writes to logrus logger,
+// mqtt.Verbose is logged at trace level
+//
+// use it with `mqtt.WithLogger` option
+func NewLogrusLogger(l logrus.FieldLogger) mqtt.Logger {
+	return &logrusLogger{l: l}
+}
+
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+func (r *logrusLogger) Log(level mqtt.LogLevel, msg string, fields ...mqtt.LogField) {
+	logrusFields := make(logrus.Fields, len(fields))
+	for _, f := range fields {
+		logrusFields[f.Key] = f.Value
+	}
+
+	entry := r.l.WithFields(logrusFields)
+	switch level {
+	case mqtt.Verbose:
+		entry.Trace(msg)
+	case mqtt.Debug:
+		entry.Debug(msg)
+	case mqtt.Info:
+		entry.Info(msg)
+	case mqtt.Warning:
+		entry.Warn(msg)
+	case mqtt.Error:
+		entry.Error(msg)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+func TestZapLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(buf),
+		zapcore.InfoLevel,
+	)
+
+	l := NewZapLogger(zap.New(core))
+	l.Log(mqtt.Debug, "ignored")
+	l.Log(mqtt.Warning, "NET publish packet dropped", mqtt.LogField{Key: mqtt.LogKeyTopic, Value: "foo"})
+
+	out := buf.String()
+	if strings.Contains(out, "ignored") {
+		t.Error("debug message should be filtered by zap level")
+	}
+
+	if !strings.Contains(out, `"level":"warn"`) || !strings.Contains(out, `"topic":"foo"`) {
+		t.Errorf("unexpected zap output %q", out)
+	}
+}
+
+func TestLogrusLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lr := logrus.New()
+	lr.Out = buf
+	lr.Formatter = &logrus.JSONFormatter{}
+	lr.Level = logrus.TraceLevel
+
+	l := NewLogrusLogger(lr)
+	l.Log(mqtt.Verbose, "NET received PubAck", mqtt.LogField{Key: mqtt.LogKeyPacketID, Value: uint16(1)})
+
+	out := buf.String()
+	if !strings.Contains(out, `"level":"trace"`) || !strings.Contains(out, `"id":1`) {
+		t.Errorf("unexpected logrus output %q", out)
+	}
+}
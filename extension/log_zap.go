@@ -0,0 +1,52 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"go.uber.org/zap"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// NewZapLogger creates a mqtt.Logger writes to zap logger,
+// mqtt.Verbose and mqtt.Debug are both logged at debug level
+//
+// use it with `mqtt.WithLogger` option
+func NewZapLogger(l *zap.Logger) mqtt.Logger {
+	return &zapLogger{l: l.WithOptions(zap.AddCallerSkip(3))}
+}
+
+type zapLogger struct {
+	l *zap.Logger
+}
+
+func (z *zapLogger) Log(level mqtt.LogLevel, msg string, fields ...mqtt.LogField) {
+	zapFields := make([]zap.Field, len(fields))
+	for i, f := range fields {
+		zapFields[i] = zap.Any(f.Key, f.Value)
+	}
+
+	switch level {
+	case mqtt.Verbose, mqtt.Debug:
+		z.l.Debug(msg, zapFields...)
+	case mqtt.Info:
+		z.l.Info(msg, zapFields...)
+	case mqtt.Warning:
+		z.l.Warn(msg, zapFields...)
+	case mqtt.Error:
+		z.l.Error(msg, zapFields...)
+	}
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extension
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+const defaultPrometheusNamespace = "libmqtt"
+
+var packetTypeNames = map[mqtt.CtrlType]string{
+	mqtt.CtrlConn:      "connect",
+	mqtt.CtrlConnAck:   "connack",
+	mqtt.CtrlPublish:   "publish",
+	mqtt.CtrlPubAck:    "puback",
+	mqtt.CtrlPubRecv:   "pubrec",
+	mqtt.CtrlPubRel:    "pubrel",
+	mqtt.CtrlPubComp:   "pubcomp",
+	mqtt.CtrlSubscribe: "subscribe",
+	mqtt.CtrlSubAck:    "suback",
+	mqtt.CtrlUnSub:     "unsubscribe",
+	mqtt.CtrlUnSubAck:  "unsuback",
+	mqtt.CtrlPingReq:   "pingreq",
+	mqtt.CtrlPingResp:  "pingresp",
+	mqtt.CtrlDisConn:   "disconnect",
+	mqtt.CtrlAuth:      "auth",
+}
+
+func packetTypeName(t mqtt.CtrlType) string {
+	if name, ok := packetTypeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics, all metric names
+// are prefixed with namespace
+//
+// if namespace is empty here, the default namespace "libmqtt" will be used
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	if namespace == "" {
+		namespace = defaultPrometheusNamespace
+	}
+
+	return &PrometheusMetrics{
+		namespace: namespace,
+		mu:        &sync.Mutex{},
+		counters:  make(map[string]map[string]float64),
+		gauges:    make(map[string]map[string]float64),
+		summaries: make(map[string]map[string]*summary),
+	}
+}
+
+type summary struct {
+	sum   float64
+	count uint64
+}
+
+// PrometheusMetrics implements mqtt.Metrics, and exports the collected
+// metrics in Prometheus text format as a http.Handler
+//
+// use it with `mqtt.WithMetrics` option, and serve it with
+//
+//	http.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	namespace string
+	mu        *sync.Mutex
+
+	// metric name -> labels -> value
+	counters  map[string]map[string]float64
+	gauges    map[string]map[string]float64
+	summaries map[string]map[string]*summary
+}
+
+// PacketSent counts packets and bytes sent to server
+func (p *PrometheusMetrics) PacketSent(server string, t mqtt.CtrlType, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.add("packets_sent_total", labels("server", server, "type", packetTypeName(t)), 1)
+	p.add("sent_bytes_total", labels("server", server), float64(size))
+}
+
+// PacketRecv counts packets and bytes received from server
+func (p *PrometheusMetrics) PacketRecv(server string, t mqtt.CtrlType, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.add("packets_received_total", labels("server", server, "type", packetTypeName(t)), 1)
+	p.add("received_bytes_total", labels("server", server), float64(size))
+}
+
+// Inflight records the count of publish packets waiting for ack
+func (p *PrometheusMetrics) Inflight(qos mqtt.QosLevel, count int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.set("inflight_messages", labels("qos", strconv.Itoa(int(qos))), float64(count))
+}
+
+// QueueDepth records the count of buffered packets in send and recv channel
+func (p *PrometheusMetrics) QueueDepth(send, recv int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.set("queue_depth", labels("queue", "send"), float64(send))
+	p.set("queue_depth", labels("queue", "recv"), float64(recv))
+}
+
+// PersistError counts persist errors
+func (p *PrometheusMetrics) PersistError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.add("persist_errors_total", "", 1)
+}
+
+// Reconnect counts reconnect attempts to server
+func (p *PrometheusMetrics) Reconnect(server string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.add("reconnects_total", labels("server", server), 1)
+}
+
+// AckLatency records the latency between packet sent and acknowledged
+func (p *PrometheusMetrics) AckLatency(server string, t mqtt.CtrlType, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	name := "ack_latency_seconds"
+	l := labels("server", server, "type", packetTypeName(t))
+	if p.summaries[name] == nil {
+		p.summaries[name] = make(map[string]*summary)
+	}
+
+	s, ok := p.summaries[name][l]
+	if !ok {
+		s = &summary{}
+		p.summaries[name][l] = s
+	}
+	s.sum += latency.Seconds()
+	s.count++
+}
+
+// Throttled counts publish packets delayed or dropped by rate limit
+func (p *PrometheusMetrics) Throttled(topic string, dropped bool, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	action := "delayed"
+	if dropped {
+		action = "dropped"
+	}
+	p.add("throttled_messages_total", labels("action", action), 1)
+	p.add("throttled_bytes_total", labels("action", action), float64(size))
+}
+
+// ServeHTTP writes all metrics in Prometheus text format
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(p.Bytes())
+}
+
+// Bytes returns all metrics in Prometheus text format
+func (p *PrometheusMetrics) Bytes() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	writeValues := func(typ string, m map[string]map[string]float64) {
+		for _, name := range sortedNames(m) {
+			fullName := p.namespace + "_" + name
+			fmt.Fprintf(buf, "# TYPE %s %s\n", fullName, typ)
+			for _, l := range sortedLabels(m[name]) {
+				fmt.Fprintf(buf, "%s%s %s\n", fullName, l, formatValue(m[name][l]))
+			}
+		}
+	}
+
+	writeValues("counter", p.counters)
+	writeValues("gauge", p.gauges)
+
+	sums := make(map[string]map[string]float64)
+	for name, m := range p.summaries {
+		sums[name] = make(map[string]float64)
+		for l, s := range m {
+			sums[name][l] = s.sum
+		}
+	}
+
+	for _, name := range sortedNames(sums) {
+		fullName := p.namespace + "_" + name
+		fmt.Fprintf(buf, "# TYPE %s summary\n", fullName)
+		for _, l := range sortedLabels(sums[name]) {
+			s := p.summaries[name][l]
+			fmt.Fprintf(buf, "%s_sum%s %s\n", fullName, l, formatValue(s.sum))
+			fmt.Fprintf(buf, "%s_count%s %d\n", fullName, l, s.count)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (p *PrometheusMetrics) add(name, labels string, v float64) {
+	if p.counters[name] == nil {
+		p.counters[name] = make(map[string]float64)
+	}
+	p.counters[name][labels] += v
+}
+
+func (p *PrometheusMetrics) set(name, labels string, v float64) {
+	if p.gauges[name] == nil {
+		p.gauges[name] = make(map[string]float64)
+	}
+	p.gauges[name][labels] = v
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats key value pairs as Prometheus labels
+func labels(kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		pairs = append(pairs, kv[i]+`="`+labelValueEscaper.Replace(kv[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedNames(m map[string]map[string]float64) []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedLabels(m map[string]float64) []string {
+	ls := make([]string, 0, len(m))
+	for k := range m {
+		ls = append(ls, k)
+	}
+	sort.Strings(ls)
+	return ls
+}
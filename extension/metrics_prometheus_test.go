@@ -0,0 +1,68 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extension
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+func TestPrometheusMetrics_ServeHTTP(t *testing.T) {
+	m := NewPrometheusMetrics("")
+	m.PacketSent("localhost:1883", mqtt.CtrlPublish, 10)
+	m.PacketSent("localhost:1883", mqtt.CtrlPublish, 20)
+	m.PacketRecv("localhost:1883", mqtt.CtrlPubAck, 4)
+	m.Inflight(mqtt.Qos1, 3)
+	m.QueueDepth(1, 2)
+	m.Reconnect("localhost:1883")
+	m.AckLatency("localhost:1883", mqtt.CtrlPubAck, 500*time.Millisecond)
+	m.Throttled("foo", true, 8)
+
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	for _, line := range []string{
+		"# TYPE libmqtt_packets_sent_total counter",
+		`libmqtt_packets_sent_total{server="localhost:1883",type="publish"} 2`,
+		`libmqtt_sent_bytes_total{server="localhost:1883"} 30`,
+		`libmqtt_packets_received_total{server="localhost:1883",type="puback"} 1`,
+		"# TYPE libmqtt_inflight_messages gauge",
+		`libmqtt_inflight_messages{qos="1"} 3`,
+		`libmqtt_queue_depth{queue="recv"} 2`,
+		`libmqtt_reconnects_total{server="localhost:1883"} 1`,
+		"# TYPE libmqtt_ack_latency_seconds summary",
+		`libmqtt_ack_latency_seconds_sum{server="localhost:1883",type="puback"} 0.5`,
+		`libmqtt_ack_latency_seconds_count{server="localhost:1883",type="puback"} 1`,
+		`libmqtt_throttled_bytes_total{action="dropped"} 8`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("metrics output missing line %q, output:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/goiiot/libmqtt/extension/quic
+
+go 1.26.0
+
+require (
+	github.com/goiiot/libmqtt v0.0.0
+	github.com/quic-go/quic-go v0.63.0
+)
+
+require (
+	golang.org/x/crypto v0.54.0 // indirect
+	golang.org/x/net v0.56.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)
+
+replace github.com/goiiot/libmqtt => ../../
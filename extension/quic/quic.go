@@ -0,0 +1,102 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package quic provides MQTT over QUIC transport for libmqtt client
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/goiiot/libmqtt"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// ALPN is the application layer protocol negotiated for MQTT over QUIC
+const ALPN = "mqtt"
+
+// NewTransport creates the transport running MQTT over a QUIC stream,
+// register it to client with
+//
+//	libmqtt.WithTransport("quic", quic.NewTransport(nil))
+//
+// and use server address like `quic://host:port`, the connection is always
+// secured with TLS, the Dialer and proxy of client are not used
+//
+// TLS session tickets are cached in the transport, reconnections to the
+// same server use 0-RTT when the server allows
+//
+// config is the QUIC config, nil for default
+func NewTransport(config *quicgo.Config) libmqtt.Transport {
+	sessions := tls.NewLRUClientSessionCache(0)
+
+	return func(ctx context.Context, dialer libmqtt.Dialer, address string, tlsConfig *tls.Config) (net.Conn, error) {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+
+		if len(tlsConfig.NextProtos) == 0 {
+			tlsConfig.NextProtos = []string{ALPN}
+		}
+
+		if tlsConfig.ServerName == "" && !tlsConfig.InsecureSkipVerify {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(address)
+		}
+
+		if tlsConfig.ClientSessionCache == nil {
+			tlsConfig.ClientSessionCache = sessions
+		}
+
+		conn, err := quicgo.DialAddrEarly(ctx, address, tlsConfig, config)
+		if err != nil {
+			return nil, err
+		}
+
+		stream, err := conn.OpenStreamSync(ctx)
+		if err != nil {
+			conn.CloseWithError(0, "")
+			return nil, err
+		}
+
+		return &streamConn{Stream: stream, conn: conn}, nil
+	}
+}
+
+// streamConn is the net.Conn over QUIC stream
+type streamConn struct {
+	*quicgo.Stream
+	conn *quicgo.Conn
+}
+
+// Close the stream and the QUIC connection
+func (c *streamConn) Close() error {
+	c.Stream.CancelRead(0)
+	err := c.Stream.Close()
+	c.conn.CloseWithError(0, "")
+	return err
+}
+
+// LocalAddr of the QUIC connection
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr of the QUIC connection
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
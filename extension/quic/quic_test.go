@@ -0,0 +1,138 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package quic
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goiiot/libmqtt"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// newTestCert creates self signed certificate for 127.0.0.1
+func newTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, roots
+}
+
+// serveTestBroker accepts MQTT over QUIC connections, acknowledges the
+// connect packet and closes the connection, reports whether 0-RTT used
+func serveTestBroker(l *quicgo.EarlyListener, used0RTT chan bool) {
+	for {
+		conn, err := l.Accept(context.Background())
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.CloseWithError(0, "")
+
+			stream, err := conn.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+
+			pkt, err := libmqtt.Decode(libmqtt.V311, bufio.NewReader(stream))
+			if err != nil || pkt.Type() != libmqtt.CtrlConn {
+				return
+			}
+
+			w := bufio.NewWriter(stream)
+			(&libmqtt.ConnAckPacket{}).WriteTo(w)
+			w.Flush()
+
+			<-conn.HandshakeComplete()
+			used0RTT <- conn.ConnectionState().Used0RTT
+
+			// wait for session ticket received by client
+			time.Sleep(100 * time.Millisecond)
+		}()
+	}
+}
+
+func TestTransport(t *testing.T) {
+	cert, roots := newTestCert(t)
+	l, err := quicgo.ListenAddrEarly("127.0.0.1:0",
+		&tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{ALPN}},
+		&quicgo.Config{Allow0RTT: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	used0RTT := make(chan bool, 2)
+	go serveTestBroker(l, used0RTT)
+
+	c, err := libmqtt.NewClient(
+		libmqtt.WithServer("quic://"+l.Addr().String()),
+		libmqtt.WithTransport("quic", NewTransport(nil)),
+		libmqtt.WithCustomTLS(&tls.Config{RootCAs: roots}),
+		libmqtt.WithAutoReconnect(true),
+		libmqtt.WithBackoffStrategy(10*time.Millisecond, 10*time.Millisecond, 1),
+		libmqtt.WithLog(libmqtt.Silent),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Destroy(true)
+		c.Wait()
+	}()
+
+	c.Connect(nil)
+	for i, target := range []bool{false, true} {
+		select {
+		case used := <-used0RTT:
+			if used != target {
+				t.Errorf("connection %d used 0-RTT = %v, target = %v", i, used, target)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("connection %d timeout", i)
+		}
+	}
+}
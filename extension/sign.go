@@ -0,0 +1,381 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// SignAlgorithm is the algorithm to sign publish packets
+type SignAlgorithm byte
+
+// Supported sign algorithms
+const (
+	HMACSHA256 SignAlgorithm = iota + 1
+	Ed25519
+)
+
+var signAlgorithmNames = map[SignAlgorithm]string{
+	HMACSHA256: "hmac-sha256",
+	Ed25519:    "ed25519",
+}
+
+// user property keys of signature
+const (
+	sigPropAlgorithm = "sig-alg"
+	sigPropKeyID     = "sig-kid"
+	sigPropCovered   = "sig-props"
+	sigPropValue     = "sig"
+)
+
+// signature envelope header magic and version
+const (
+	sigEnvelopeMagic   = 0x5A
+	sigEnvelopeVersion = 0x01
+)
+
+var (
+	// ErrUnsigned is the error when received publish packet not signed
+	ErrUnsigned = errors.New("message not signed ")
+
+	// ErrBadSignature is the error when signature of publish packet is invalid
+	ErrBadSignature = errors.New("bad message signature ")
+
+	// ErrUnknownSigner is the error when no key found for the signer key id
+	ErrUnknownSigner = errors.New("unknown message signer ")
+)
+
+// NewHMACSigner creates a MessageSigner signs with HMAC-SHA256
+func NewHMACSigner(keyID string, key []byte) *MessageSigner {
+	return &MessageSigner{alg: HMACSHA256, keyID: keyID, hmacKey: key}
+}
+
+// NewEd25519Signer creates a MessageSigner signs with Ed25519
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) *MessageSigner {
+	return &MessageSigner{alg: Ed25519, keyID: keyID, privateKey: key}
+}
+
+// MessageSigner signs publish packets, the signature covers topic name,
+// payload and (in MQTT 5) payload format, content type, response topic,
+// correlation data and selected user properties
+//
+// the signature is carried in user properties in MQTT 5, and in a header
+// prepended to the payload in MQTT 3.1.1
+//
+// use `Sign` as send interceptor, or call it before `Publish` if
+// `WithCompression` is used, since send interceptors see compressed payloads
+// while verification happens after decompression
+type MessageSigner struct {
+	alg        SignAlgorithm
+	keyID      string
+	hmacKey    []byte
+	privateKey ed25519.PrivateKey
+	userProps  []string
+}
+
+// CoverUserProps adds user properties to be covered by signature
+func (s *MessageSigner) CoverUserProps(keys ...string) *MessageSigner {
+	s.userProps = append(s.userProps, keys...)
+	sort.Strings(s.userProps)
+	return s
+}
+
+// Sign returns a signed copy of the publish packet,
+// other packets are returned untouched
+func (s *MessageSigner) Sign(server string, pkt mqtt.Packet) (mqtt.Packet, error) {
+	p, ok := pkt.(*mqtt.PublishPacket)
+	if !ok {
+		return pkt, nil
+	}
+
+	result := *p
+	if p.ProtoVersion == mqtt.V5 {
+		result.Props = copyPublishProps(p.Props)
+		props := result.Props.UserProps
+		props.Set(sigPropAlgorithm, signAlgorithmNames[s.alg])
+		props.Set(sigPropKeyID, s.keyID)
+		props.Set(sigPropCovered, strings.Join(s.userProps, ","))
+
+		sig, err := s.sign(signedData(s.alg, s.keyID, &result, s.userProps))
+		if err != nil {
+			return nil, err
+		}
+
+		props.Set(sigPropValue, base64.StdEncoding.EncodeToString(sig))
+		return &result, nil
+	}
+
+	if len(s.keyID) > 255 {
+		return nil, ErrBadSignature
+	}
+
+	sig, err := s.sign(signedData(s.alg, s.keyID, &result, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	// | magic | version | alg | key id length | key id | sig length | sig | payload |
+	payload := make([]byte, 0, 5+len(s.keyID)+len(sig)+len(p.Payload))
+	payload = append(payload, sigEnvelopeMagic, sigEnvelopeVersion, byte(s.alg), byte(len(s.keyID)))
+	payload = append(payload, s.keyID...)
+	payload = append(payload, byte(len(sig)))
+	payload = append(payload, sig...)
+	result.Payload = append(payload, p.Payload...)
+	return &result, nil
+}
+
+func (s *MessageSigner) sign(data []byte) ([]byte, error) {
+	switch s.alg {
+	case HMACSHA256:
+		mac := hmac.New(sha256.New, s.hmacKey)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	case Ed25519:
+		if len(s.privateKey) != ed25519.PrivateKeySize {
+			return nil, ErrBadSignature
+		}
+		return ed25519.Sign(s.privateKey, data), nil
+	default:
+		return nil, ErrBadSignature
+	}
+}
+
+// signedData is the canonical form of the publish packet to sign
+func signedData(alg SignAlgorithm, keyID string, p *mqtt.PublishPacket, userProps []string) []byte {
+	data := []byte("libmqtt-sig-v1")
+	appendField := func(v []byte) {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(v)))
+		data = append(data, size[:]...)
+		data = append(data, v...)
+	}
+
+	appendField([]byte{byte(alg)})
+	appendField([]byte(keyID))
+	appendField([]byte(p.TopicName))
+	appendField(p.Payload)
+
+	if p.ProtoVersion == mqtt.V5 && p.Props != nil {
+		appendField([]byte{p.Props.PayloadFormat})
+		appendField([]byte(p.Props.ContentType))
+		appendField([]byte(p.Props.RespTopic))
+		appendField(p.Props.CorrelationData)
+
+		appendField([]byte(strings.Join(userProps, ",")))
+		for _, k := range userProps {
+			appendField([]byte(k))
+			for _, v := range p.Props.UserProps[k] {
+				appendField([]byte(v))
+			}
+		}
+	}
+
+	return data
+}
+
+// NewSignatureVerifier creates an empty SignatureVerifier
+func NewSignatureVerifier() *SignatureVerifier {
+	return &SignatureVerifier{
+		mu:         &sync.RWMutex{},
+		hmacKeys:   make(map[string][]byte),
+		publicKeys: make(map[string]ed25519.PublicKey),
+	}
+}
+
+// SignatureVerifier verifies signatures of publish packets signed by MessageSigner
+type SignatureVerifier struct {
+	mu         *sync.RWMutex
+	hmacKeys   map[string][]byte
+	publicKeys map[string]ed25519.PublicKey
+}
+
+// AddHMACKey adds HMAC-SHA256 key of signer key id
+func (v *SignatureVerifier) AddHMACKey(keyID string, key []byte) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.hmacKeys[keyID] = key
+}
+
+// AddEd25519Key adds Ed25519 public key of signer key id
+func (v *SignatureVerifier) AddEd25519Key(keyID string, key ed25519.PublicKey) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.publicKeys[keyID] = key
+}
+
+// Verify the signature of publish packet, returns a copy of the
+// packet with signature removed
+func (v *SignatureVerifier) Verify(p *mqtt.PublishPacket) (*mqtt.PublishPacket, error) {
+	if p.Props != nil && p.Props.UserProps.Get(sigPropValue) != "" {
+		props := p.Props.UserProps
+		var alg SignAlgorithm
+		for k, name := range signAlgorithmNames {
+			if name == props.Get(sigPropAlgorithm) {
+				alg = k
+			}
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(props.Get(sigPropValue))
+		if err != nil {
+			return nil, ErrBadSignature
+		}
+
+		var covered []string
+		if c := props.Get(sigPropCovered); c != "" {
+			covered = strings.Split(c, ",")
+		}
+
+		// signature was made without the signature itself
+		signed := *p
+		signed.ProtoVersion = mqtt.V5
+		signed.Props = copyPublishProps(p.Props)
+		signed.Props.UserProps.Del(sigPropValue)
+		if err = v.verify(alg, props.Get(sigPropKeyID), signedData(alg, props.Get(sigPropKeyID), &signed, covered), sig); err != nil {
+			return nil, err
+		}
+
+		for _, k := range []string{sigPropAlgorithm, sigPropKeyID, sigPropCovered} {
+			signed.Props.UserProps.Del(k)
+		}
+		return &signed, nil
+	}
+
+	data := p.Payload
+	if len(data) < 5 || data[0] != sigEnvelopeMagic {
+		return nil, ErrUnsigned
+	}
+
+	if data[1] != sigEnvelopeVersion || len(data) < 5+int(data[3]) {
+		return nil, ErrBadSignature
+	}
+
+	alg, keyID, data := SignAlgorithm(data[2]), string(data[4:4+int(data[3])]), data[4+int(data[3]):]
+	if len(data) < 1+int(data[0]) {
+		return nil, ErrBadSignature
+	}
+
+	sig, payload := data[1:1+int(data[0])], data[1+int(data[0]):]
+	signed := *p
+	signed.ProtoVersion = mqtt.V311
+	signed.Payload = payload
+	if err := v.verify(alg, keyID, signedData(alg, keyID, &signed, nil), sig); err != nil {
+		return nil, err
+	}
+
+	signed.ProtoVersion = p.ProtoVersion
+	return &signed, nil
+}
+
+func (v *SignatureVerifier) verify(alg SignAlgorithm, keyID string, data, sig []byte) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	switch alg {
+	case HMACSHA256:
+		key, ok := v.hmacKeys[keyID]
+		if !ok {
+			return ErrUnknownSigner
+		}
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrBadSignature
+		}
+	case Ed25519:
+		key, ok := v.publicKeys[keyID]
+		if !ok {
+			return ErrUnknownSigner
+		}
+
+		if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, data, sig) {
+			return ErrBadSignature
+		}
+	default:
+		return ErrBadSignature
+	}
+
+	return nil
+}
+
+// NewVerifyingRouter creates a VerifyingRouter dispatches verified messages
+// to router, rejected messages are reported to onReject (if not nil)
+func NewVerifyingRouter(router mqtt.TopicRouter, verifier *SignatureVerifier, onReject func(topic string, err error)) *VerifyingRouter {
+	return &VerifyingRouter{router: router, verifier: verifier, onReject: onReject}
+}
+
+// VerifyingRouter is a mqtt.TopicRouter wrapper, which only dispatches
+// messages with valid signature, the signature is removed before dispatch
+type VerifyingRouter struct {
+	router   mqtt.TopicRouter
+	verifier *SignatureVerifier
+	onReject func(topic string, err error)
+}
+
+// Name is the name of router
+func (r *VerifyingRouter) Name() string {
+	if r == nil {
+		return "<nil>"
+	}
+	return "VerifyingRouter(" + r.router.Name() + ")"
+}
+
+// Handle registers topic handler to the wrapped router
+func (r *VerifyingRouter) Handle(topic string, h mqtt.TopicHandler) {
+	r.router.Handle(topic, h)
+}
+
+// HandlePacket registers packet handler to the wrapped router, the
+// handler receives the verified packet with signature removed, if the
+// wrapped router does not support packet handlers, the packet passed
+// to h has topic name, qos and payload only
+func (r *VerifyingRouter) HandlePacket(topic string, h mqtt.PacketHandler) {
+	if pr, ok := r.router.(interface {
+		HandlePacket(topic string, h mqtt.PacketHandler)
+	}); ok {
+		pr.HandlePacket(topic, h)
+		return
+	}
+
+	r.router.Handle(topic, func(topic string, qos mqtt.QosLevel, msg []byte) {
+		h(&mqtt.PublishPacket{TopicName: topic, Qos: qos, Payload: msg})
+	})
+}
+
+// Dispatch verifies the publish packet and dispatches it with wrapped router
+func (r *VerifyingRouter) Dispatch(p *mqtt.PublishPacket) {
+	verified, err := r.verifier.Verify(p)
+	if err != nil {
+		if r.onReject != nil {
+			r.onReject(p.TopicName, err)
+		}
+		return
+	}
+
+	r.router.Dispatch(verified)
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package extension
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+// signAndTransfer signs the packet and decodes it as received from server
+func signAndTransfer(t *testing.T, s *MessageSigner, p *mqtt.PublishPacket) *mqtt.PublishPacket {
+	pkt, err := s.Sign("", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := mqtt.Decode(p.ProtoVersion, bytes.NewReader(pkt.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return received.(*mqtt.PublishPacket)
+}
+
+func newTestSigners(t *testing.T) ([]*MessageSigner, *SignatureVerifier) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewSignatureVerifier()
+	v.AddHMACKey("hmac", []byte("secret"))
+	v.AddEd25519Key("ed", pub)
+	return []*MessageSigner{
+		NewHMACSigner("hmac", []byte("secret")).CoverUserProps("cmd"),
+		NewEd25519Signer("ed", priv).CoverUserProps("cmd"),
+	}, v
+}
+
+func TestMessageSigner(t *testing.T) {
+	signers, v := newTestSigners(t)
+	for _, s := range signers {
+		for _, version := range []mqtt.ProtoVersion{mqtt.V311, mqtt.V5} {
+			p := &mqtt.PublishPacket{
+				BasePacket: mqtt.BasePacket{ProtoVersion: version},
+				TopicName:  "cmd/reboot",
+				Qos:        mqtt.Qos1,
+				PacketID:   1,
+				Payload:    []byte("now"),
+				Props:      &mqtt.PublishProps{UserProps: mqtt.UserProps{"cmd": {"reboot"}}},
+			}
+
+			received := signAndTransfer(t, s, p)
+			verified, err := v.Verify(received)
+			if err != nil {
+				t.Fatalf("signer %s version %d verify failed: %v", s.keyID, version, err)
+			}
+
+			if string(verified.Payload) != "now" {
+				t.Errorf("verified payload = %q", verified.Payload)
+			}
+
+			if version == mqtt.V5 && (len(verified.Props.UserProps) != 1 || verified.Props.UserProps.Get("cmd") != "reboot") {
+				t.Errorf("signature props not removed %v", verified.Props.UserProps)
+			}
+
+			tampered := *received
+			tampered.TopicName = "cmd/shutdown"
+			if _, err = v.Verify(&tampered); err != ErrBadSignature {
+				t.Errorf("signer %s version %d tampered topic err = %v", s.keyID, version, err)
+			}
+
+			tampered = *received
+			tampered.Payload = append([]byte(nil), received.Payload...)
+			tampered.Payload[len(tampered.Payload)-1] ^= 0xff
+			if _, err = v.Verify(&tampered); err != ErrBadSignature {
+				t.Errorf("signer %s version %d tampered payload err = %v", s.keyID, version, err)
+			}
+
+			if version == mqtt.V5 {
+				received.Props.UserProps.Set("cmd", "shutdown")
+				if _, err = v.Verify(received); err != ErrBadSignature {
+					t.Errorf("signer %s tampered user property err = %v", s.keyID, err)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifyingRouter(t *testing.T) {
+	signers, v := newTestSigners(t)
+
+	var rejected []error
+	r := NewVerifyingRouter(mqtt.NewTextRouter(), v, func(topic string, err error) {
+		rejected = append(rejected, err)
+	})
+
+	var dispatched []string
+	r.Handle("cmd", func(topic string, qos mqtt.QosLevel, msg []byte) {
+		dispatched = append(dispatched, string(msg))
+	})
+
+	p := &mqtt.PublishPacket{BasePacket: mqtt.BasePacket{ProtoVersion: mqtt.V5}, TopicName: "cmd", Payload: []byte("signed")}
+	r.Dispatch(signAndTransfer(t, signers[0], p))
+	r.Dispatch(&mqtt.PublishPacket{TopicName: "cmd", Payload: []byte("unsigned")})
+
+	unknown := NewHMACSigner("unknown", []byte("secret"))
+	r.Dispatch(signAndTransfer(t, unknown, p))
+
+	if len(dispatched) != 1 || dispatched[0] != "signed" {
+		t.Errorf("unexpected dispatched messages %v", dispatched)
+	}
+
+	if len(rejected) != 2 || rejected[0] != ErrUnsigned || rejected[1] != ErrUnknownSigner {
+		t.Errorf("unexpected rejections %v", rejected)
+	}
+}
+
+func TestVerifyingRouter_HandlePacket(t *testing.T) {
+	signers, v := newTestSigners(t)
+	r := NewVerifyingRouter(mqtt.NewTextRouter(), v, nil)
+
+	var received *mqtt.PublishPacket
+	r.HandlePacket("cmd", func(p *mqtt.PublishPacket) {
+		received = p
+	})
+
+	// mqtt 3.1.1 carries the signature envelope in payload
+	p := &mqtt.PublishPacket{BasePacket: mqtt.BasePacket{ProtoVersion: mqtt.V311}, TopicName: "cmd", Payload: []byte("signed")}
+	r.Dispatch(signAndTransfer(t, signers[0], p))
+
+	if received == nil || string(received.Payload) != "signed" {
+		t.Errorf("packet handler received %v, target = verified payload", received)
+	}
+
+	// router without packet handler support
+	received = nil
+	r = NewVerifyingRouter(struct{ mqtt.TopicRouter }{mqtt.NewTextRouter()}, v, nil)
+	r.HandlePacket("cmd", func(p *mqtt.PublishPacket) {
+		received = p
+	})
+	r.Dispatch(signAndTransfer(t, signers[0], p))
+
+	if received == nil || string(received.Payload) != "signed" {
+		t.Errorf("packet handler received %v with topic router, target = verified payload", received)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extension
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+const (
+	traceParentKey = "traceparent"
+	traceStateKey  = "tracestate"
+)
+
+// TraceContext is the W3C trace context
+// (https://www.w3.org/TR/trace-context/)
+type TraceContext struct {
+	// TraceParent in the form of `version-traceid-parentid-flags`
+	TraceParent string
+	// TraceState is vendor specific trace data, optional
+	TraceState string
+}
+
+type traceContextKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying the trace context
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext returns the trace context carried by ctx
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// W3CTracePropagator implements mqtt.TracePropagator, it carries the
+// TraceContext in ctx as `traceparent` and `tracestate` user properties
+//
+// OpenTelemetry users can implement mqtt.TracePropagator by calling
+// `propagation.TraceContext{}.Inject(ctx, props)` and Extract directly,
+// since mqtt.UserProps implements the TextMapCarrier interface
+type W3CTracePropagator struct{}
+
+// Inject TraceContext in ctx into props, invalid traceparent is ignored
+func (W3CTracePropagator) Inject(ctx context.Context, props mqtt.UserProps) {
+	tc, ok := TraceFromContext(ctx)
+	if !ok || !validTraceParent(tc.TraceParent) {
+		return
+	}
+
+	props.Set(traceParentKey, tc.TraceParent)
+	if tc.TraceState != "" {
+		props.Set(traceStateKey, tc.TraceState)
+	}
+}
+
+// Extract TraceContext from props, ctx is returned untouched
+// if no valid traceparent found
+func (W3CTracePropagator) Extract(ctx context.Context, props mqtt.UserProps) context.Context {
+	parent := strings.TrimSpace(props.Get(traceParentKey))
+	if !validTraceParent(parent) {
+		return ctx
+	}
+
+	return ContextWithTrace(ctx, TraceContext{
+		TraceParent: parent,
+		TraceState:  strings.TrimSpace(props.Get(traceStateKey)),
+	})
+}
+
+// validTraceParent checks the version 00 traceparent format
+func validTraceParent(s string) bool {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 {
+		return false
+	}
+
+	for i, size := range []int{2, 32, 16, 2} {
+		if len(parts[i]) != size || strings.ToLower(parts[i]) != parts[i] {
+			return false
+		}
+
+		b, err := hex.DecodeString(parts[i])
+		if err != nil {
+			return false
+		}
+
+		// all zero trace id and parent id are invalid
+		if (i == 1 || i == 2) && strings.Trim(parts[i], "0") == "" {
+			return false
+		}
+
+		if i == 0 && b[0] == 0xff {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extension
+
+import (
+	"context"
+	"testing"
+
+	mqtt "github.com/goiiot/libmqtt"
+)
+
+const testTraceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+func TestW3CTracePropagator(t *testing.T) {
+	p := W3CTracePropagator{}
+	props := make(mqtt.UserProps)
+
+	ctx := ContextWithTrace(context.Background(), TraceContext{
+		TraceParent: testTraceParent,
+		TraceState:  "vendor=value",
+	})
+	p.Inject(ctx, props)
+
+	if props.Get("traceparent") != testTraceParent || props.Get("tracestate") != "vendor=value" {
+		t.Fatalf("unexpected injected props %v", props)
+	}
+
+	tc, ok := TraceFromContext(p.Extract(context.Background(), props))
+	if !ok || tc.TraceParent != testTraceParent || tc.TraceState != "vendor=value" {
+		t.Errorf("unexpected extracted trace context %+v", tc)
+	}
+}
+
+func TestW3CTracePropagator_Invalid(t *testing.T) {
+	p := W3CTracePropagator{}
+	for _, parent := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01",
+	} {
+		props := mqtt.UserProps{"traceparent": {parent}}
+		if _, ok := TraceFromContext(p.Extract(context.Background(), props)); ok {
+			t.Errorf("invalid traceparent %q extracted", parent)
+		}
+
+		props = make(mqtt.UserProps)
+		p.Inject(ContextWithTrace(context.Background(), TraceContext{TraceParent: parent}), props)
+		if len(props) != 0 {
+			t.Errorf("invalid traceparent %q injected", parent)
+		}
+	}
+}
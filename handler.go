@@ -16,6 +16,8 @@
 
 package libmqtt
 
+import "context"
+
 // ConnHandler is the handler which tend to the Connect result
 // server is the server address provided by user in client creation call
 // code is the ConnResult code
@@ -28,6 +30,14 @@ type ConnHandler func(server string, code byte, err error)
 // code can be SubOkMaxQos0, SubOkMaxQos1, SubOkMaxQos2, SubFail
 type TopicHandler func(topic string, qos QosLevel, msg []byte)
 
+// PacketHandler handles topic sub message with the received publish
+// packet, including the MQTT 5 properties
+type PacketHandler func(pkt *PublishPacket)
+
+// ContextTopicHandler handles topic sub message with the context
+// carrying trace context extracted from the publish packet
+type ContextTopicHandler func(ctx context.Context, pkt *PublishPacket)
+
 // PubHandler handles the error occurred when publish some message
 // if err is not nil, that means a error occurred when sending pub msg
 type PubHandler func(topic string, err error)
@@ -44,3 +54,10 @@ type NetHandler func(server string, err error)
 
 // PersistHandler handles err happened when persist process has trouble
 type PersistHandler func(err error)
+
+// ValueHandler handles topic sub message decoded by codec
+type ValueHandler func(topic string, v interface{})
+
+// DispatchHandler handles the error occurred when a received message
+// could not be dispatched to topic handler (e.g. failed to decode)
+type DispatchHandler func(topic string, err error)
@@ -0,0 +1,108 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import "errors"
+
+var (
+	// ErrPacketDropped is the error when interceptor dropped a packet
+	// without providing an error
+	ErrPacketDropped = errors.New("packet dropped by interceptor ")
+)
+
+// Interceptor inspects, mutates or vetoes packets sent to or received
+// from server, the protocol version of packets is set to the version
+// in use with the server before calling interceptors
+//
+// return the packet (the same one or a replacement) to continue,
+// return a non nil error to drop the packet, the error will be sent to
+// the handler of the packet (PubHandler, SubHandler, UnSubHandler,
+// or NetHandler for other packets)
+type Interceptor func(server string, pkt Packet) (Packet, error)
+
+// intercept passes the packet through interceptors in order,
+// stops at the first interceptor dropped the packet
+func intercept(chain []Interceptor, server string, pkt Packet) (Packet, error) {
+	var err error
+	for _, i := range chain {
+		if pkt, err = i(server, pkt); err != nil {
+			return nil, err
+		} else if pkt == nil {
+			return nil, ErrPacketDropped
+		}
+	}
+
+	return pkt, nil
+}
+
+// interceptSend passes the outgoing packet through send interceptors,
+// returns nil if the packet was dropped
+func (c *clientConn) interceptSend(pkt Packet) Packet {
+	chain := c.parent.options.sendInterceptors
+	if len(chain) == 0 {
+		return pkt
+	}
+
+	result, err := intercept(chain, c.name, pkt)
+	if err == nil {
+		return result
+	}
+
+	c.parent.log.w("NET outgoing packet dropped by interceptor", logServer(c.name), logType(pkt.Type()), logErr(err))
+	switch p := pkt.(type) {
+	case *PublishPacket:
+		if p.Qos > Qos0 && p.PacketID != 0 {
+			c.parent.idGen.free(p.PacketID)
+			c.parent.addInflight(p.Qos, -1)
+			notifyPersistMsg(c.parent.msgCh, c.parent.persist.Delete(sendKey(p.PacketID)))
+		}
+		notifyPubMsg(c.parent.msgCh, p.TopicName, err)
+	case *SubscribePacket:
+		c.parent.idGen.free(p.PacketID)
+		notifySubMsg(c.parent.msgCh, p.Topics, err)
+	case *UnSubPacket:
+		c.parent.idGen.free(p.PacketID)
+		notifyUnSubMsg(c.parent.msgCh, p.TopicNames, err)
+	default:
+		notifyNetMsg(c.parent.msgCh, c.name, err)
+	}
+
+	return nil
+}
+
+// interceptRecv passes the incoming packet through recv interceptors,
+// returns nil if the packet was dropped
+//
+// a dropped publish packet is still acknowledged, but never dispatched
+func (c *clientConn) interceptRecv(pkt Packet) Packet {
+	chain := c.parent.options.recvInterceptors
+	if len(chain) == 0 {
+		return pkt
+	}
+
+	result, err := intercept(chain, c.name, pkt)
+	if err == nil {
+		return result
+	}
+
+	c.parent.log.w("NET incoming packet dropped by interceptor", logServer(c.name), logType(pkt.Type()), logErr(err))
+	if p, ok := pkt.(*PublishPacket); ok {
+		c.ackPublish(p)
+	}
+	notifyNetMsg(c.parent.msgCh, c.name, err)
+
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsyncClient_Interceptors(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	errDenied := errors.New("denied")
+	var order []string
+	c, err := NewClient(
+		WithServer(b.addr()),
+		WithSendInterceptor(
+			func(server string, pkt Packet) (Packet, error) {
+				if p, ok := pkt.(*PublishPacket); ok {
+					order = append(order, "first")
+					if strings.HasPrefix(p.TopicName, "deny/") {
+						return nil, errDenied
+					}
+
+					rewritten := *p
+					rewritten.TopicName = "rewritten/" + p.TopicName
+					return &rewritten, nil
+				}
+				return pkt, nil
+			},
+			func(server string, pkt Packet) (Packet, error) {
+				if _, ok := pkt.(*PublishPacket); ok {
+					order = append(order, "second")
+				}
+				return pkt, nil
+			},
+		),
+		WithRecvInterceptor(func(server string, pkt Packet) (Packet, error) {
+			if p, ok := pkt.(*PublishPacket); ok && p.TopicName == "rewritten/veto" {
+				return nil, nil
+			}
+			return pkt, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubErrs := make(chan error, 2)
+	c.HandlePub(func(topic string, err error) {
+		pubErrs <- err
+	})
+
+	netErrs := make(chan error, 1)
+	c.HandleNet(func(server string, err error) {
+		netErrs <- err
+	})
+
+	dispatched := make(chan string, 1)
+	c.Handle(".*", func(topic string, qos QosLevel, msg []byte) {
+		dispatched <- topic
+	})
+
+	connectTestClient(t, c)
+	c.Publish(&PublishPacket{TopicName: "deny/foo", Qos: Qos1})
+	select {
+	case err := <-pubErrs:
+		if err != errDenied {
+			t.Errorf("publish err = %v, target = %v", err, errDenied)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dropped publish not notified")
+	}
+
+	if atomic.LoadInt32(&c.inflight[Qos1]) != 0 {
+		t.Error("packet id of dropped publish not freed")
+	}
+
+	c.Subscribe(&Topic{Name: "rewritten/veto"})
+	b.waitPacket(t, CtrlSubscribe)
+	c.Publish(&PublishPacket{TopicName: "veto"})
+	if pub := b.waitPacket(t, CtrlPublish).(*PublishPacket); pub.TopicName != "rewritten/veto" {
+		t.Errorf("topic received by broker = %s, target = rewritten/veto", pub.TopicName)
+	}
+
+	select {
+	case err := <-netErrs:
+		if err != ErrPacketDropped {
+			t.Errorf("net err = %v, target = %v", err, ErrPacketDropped)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("dropped incoming publish not notified")
+	}
+
+	select {
+	case topic := <-dispatched:
+		t.Errorf("dropped publish %s dispatched", topic)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	c.Destroy(true)
+	c.Wait()
+
+	if strings.Join(order, ",") != "first,first,second" {
+		t.Errorf("unexpected interceptor order %v", order)
+	}
+}
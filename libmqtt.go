@@ -19,6 +19,47 @@ package libmqtt
 // UserProps contains user defined properties
 type UserProps map[string][]string
 
+// Get the first value of the key, empty if not found
+func (u UserProps) Get(key string) string {
+	if v := u[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Set the value of the key, replaces all existing values of the key
+func (u UserProps) Set(key, value string) {
+	u[key] = []string{value}
+}
+
+// Add a value to the key
+func (u UserProps) Add(key, value string) {
+	u[key] = append(u[key], value)
+}
+
+// Del all values of the key
+func (u UserProps) Del(key string) {
+	delete(u, key)
+}
+
+// Keys of all user properties
+func (u UserProps) Keys() []string {
+	keys := make([]string, 0, len(u))
+	for k := range u {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// clone returns a deep copy of user properties, never nil
+func (u UserProps) clone() UserProps {
+	result := make(UserProps, len(u))
+	for k, v := range u {
+		result[k] = append([]string(nil), v...)
+	}
+	return result
+}
+
 func (u UserProps) encodeTo(result []byte) []byte {
 	for k, v := range u {
 		for _, val := range v {
@@ -60,10 +101,47 @@ func (b *BasePacket) Version() ProtoVersion {
 	return V311
 }
 
+func (b *BasePacket) setVersion(version ProtoVersion) {
+	b.ProtoVersion = version
+}
+
 // Topic for both topic name and topic qos
 type Topic struct {
 	Name string
 	Qos  QosLevel
+
+	// subscription options (since MQTT 5), ignored by MQTT 3.1.1
+
+	// NoLocal if true, publish packets will not be forwarded to
+	// the connection which published them
+	NoLocal bool
+	// RetainAsPublished if true, publish packets forwarded keep the
+	// retain flag they were published with
+	RetainAsPublished bool
+	// RetainHandling specifies whether retained messages are sent when
+	// the subscription is established, one of RetainSendOnSub,
+	// RetainSendOnNewSub, RetainNoSend
+	RetainHandling byte
+}
+
+// subOptions returns the MQTT 5 subscription options byte
+func (t *Topic) subOptions() byte {
+	opts := t.Qos & 0x03
+	if t.NoLocal {
+		opts |= 0x04
+	}
+	if t.RetainAsPublished {
+		opts |= 0x08
+	}
+	return opts | (t.RetainHandling&0x03)<<4
+}
+
+// setSubOptions set Qos and subscription options from MQTT 5 options byte
+func (t *Topic) setSubOptions(opts byte) {
+	t.Qos = opts & 0x03
+	t.NoLocal = opts&0x04 != 0
+	t.RetainAsPublished = opts&0x08 != 0
+	t.RetainHandling = (opts >> 4) & 0x03
 }
 
 func (t *Topic) String() string {
@@ -112,6 +190,13 @@ const (
 	Qos2 QosLevel = 0x02 // Qos2 = 2
 )
 
+// retain handling options of subscription (since MQTT 5)
+const (
+	RetainSendOnSub    = 0 // RetainSendOnSub send retained messages at the time of the subscribe
+	RetainSendOnNewSub = 1 // RetainSendOnNewSub send retained messages only if the subscription does not currently exist
+	RetainNoSend       = 2 // RetainNoSend do not send retained messages at the time of the subscribe
+)
+
 var (
 	mqtt = []byte{0x00, 0x04, 'M', 'Q', 'T', 'T'}
 )
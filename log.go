@@ -17,8 +17,10 @@
 package libmqtt
 
 import (
+	"fmt"
+	"io"
 	"log"
-	"os"
+	"strings"
 )
 
 // LogLevel is used to set log level in client creation
@@ -39,96 +41,147 @@ const (
 	Error
 )
 
-type logger struct {
-	verbose *log.Logger
-	debug   *log.Logger
-	info    *log.Logger
-	warning *log.Logger
-	error   *log.Logger
-}
-
+// log field keys used by client
 const (
-	logFlag = log.Ltime | log.Ldate
+	LogKeyServer   = "server"
+	LogKeyType     = "type"
+	LogKeyPacketID = "id"
+	LogKeyTopic    = "topic"
+	LogKeyQos      = "qos"
+	LogKeyErr      = "err"
+	LogKeyPayload  = "payload"
+	LogKeyClientID = "client_id"
+	LogKeyUsername = "username"
+	LogKeyPassword = "password"
 )
 
-func newStdLogger() *log.Logger {
-	l := &log.Logger{}
-	l.SetFlags(logFlag)
-	l.SetOutput(os.Stderr)
-	return l
+// LogField is the key value pair attached to a log message
+type LogField struct {
+	Key   string
+	Value interface{}
 }
 
-func newLogger(l LogLevel) *logger {
-	lo := &logger{}
+// Logger is the structured logger used by client
+//
+// Log is only called with level enabled by `WithLog`,
+// so implementations are not required to filter levels again
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...LogField)
+}
 
-	if l <= Error {
-		lo.error = newStdLogger()
-		lo.error.SetPrefix("[LIBMQTT] E ")
-	}
+// LogRedaction defines the sensitive values to hide from logs
+type LogRedaction byte
 
-	if l <= Warning {
-		lo.warning = newStdLogger()
-		lo.warning.SetPrefix("[LIBMQTT] W ")
-	}
+const (
+	// RedactCredentials hides username and password
+	RedactCredentials LogRedaction = 1 << iota
+	// RedactPayload hides publish payload
+	RedactPayload
+)
 
-	if l <= Info {
-		lo.info = newStdLogger()
-		lo.info.SetPrefix("[LIBMQTT] I ")
-	}
+// defaultRedaction hides all sensitive values unless `WithLogRedaction` used
+const defaultRedaction = RedactCredentials | RedactPayload
 
-	if l <= Debug {
-		lo.debug = newStdLogger()
-		lo.debug.SetPrefix("[LIBMQTT] D ")
-	}
+const redacted = "<redacted>"
 
-	if l <= Verbose {
-		lo.verbose = newStdLogger()
-		lo.verbose.SetPrefix("[LIBMQTT] V ")
+// logger filters log messages by level, redacts sensitive fields,
+// and writes the result to the Logger
+type logger struct {
+	level  LogLevel
+	out    Logger
+	redact LogRedaction
+}
+
+func (l *logger) enabled(level LogLevel) bool {
+	return l != nil && l.out != nil && l.level != Silent && level >= l.level
+}
+
+func (l *logger) log(level LogLevel, msg string, fields []LogField) {
+	if !l.enabled(level) {
+		return
 	}
 
-	if l <= Silent {
-		lo = nil
+	if l.redact != 0 {
+		for i, f := range fields {
+			switch f.Key {
+			case LogKeyUsername, LogKeyPassword:
+				if l.redact&RedactCredentials != 0 {
+					fields[i].Value = redacted
+				}
+			case LogKeyPayload:
+				if l.redact&RedactPayload != 0 {
+					fields[i].Value = redacted
+				}
+			}
+		}
 	}
 
-	return lo
+	l.out.Log(level, msg, fields...)
 }
 
 // verbose
-func (l *logger) v(data ...interface{}) {
-	if l == nil || l.verbose == nil {
-		return
-	}
-	l.verbose.Println(data...)
-}
+func (l *logger) v(msg string, fields ...LogField) { l.log(Verbose, msg, fields) }
 
 // debug
-func (l *logger) d(data ...interface{}) {
-	if l == nil || l.debug == nil {
-		return
-	}
-	l.debug.Println(data...)
-}
+func (l *logger) d(msg string, fields ...LogField) { l.log(Debug, msg, fields) }
 
 // info
-func (l *logger) i(data ...interface{}) {
-	if l == nil || l.info == nil {
-		return
-	}
-	l.info.Println(data...)
-}
+func (l *logger) i(msg string, fields ...LogField) { l.log(Info, msg, fields) }
 
 // warning
-func (l *logger) w(data ...interface{}) {
-	if l == nil || l.warning == nil {
-		return
-	}
-	l.warning.Println(data...)
-}
+func (l *logger) w(msg string, fields ...LogField) { l.log(Warning, msg, fields) }
 
 // error
-func (l *logger) e(data ...interface{}) {
-	if l == nil || l.error == nil {
-		return
+func (l *logger) e(msg string, fields ...LogField) { l.log(Error, msg, fields) }
+
+func logServer(server string) LogField   { return LogField{Key: LogKeyServer, Value: server} }
+func logType(t CtrlType) LogField        { return LogField{Key: LogKeyType, Value: t} }
+func logID(id uint16) LogField           { return LogField{Key: LogKeyPacketID, Value: id} }
+func logTopic(topic string) LogField     { return LogField{Key: LogKeyTopic, Value: topic} }
+func logQos(qos QosLevel) LogField       { return LogField{Key: LogKeyQos, Value: qos} }
+func logErr(err error) LogField          { return LogField{Key: LogKeyErr, Value: err} }
+func logPayload(payload []byte) LogField { return LogField{Key: LogKeyPayload, Value: payload} }
+
+func logField(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
+
+var logPrefixes = map[LogLevel]string{
+	Verbose: "[LIBMQTT] V ",
+	Debug:   "[LIBMQTT] D ",
+	Info:    "[LIBMQTT] I ",
+	Warning: "[LIBMQTT] W ",
+	Error:   "[LIBMQTT] E ",
+}
+
+const (
+	logFlag = log.Ltime | log.Ldate
+)
+
+// stdLogger is the default Logger writes `key=value` formatted
+// messages with standard log package
+type stdLogger struct {
+	out *log.Logger
+}
+
+func newStdLogger(w io.Writer) *stdLogger {
+	return &stdLogger{out: log.New(w, "", logFlag)}
+}
+
+func (s *stdLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	b := &strings.Builder{}
+	b.WriteString(logPrefixes[level])
+	b.WriteString(msg)
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		switch v := f.Value.(type) {
+		case []byte:
+			fmt.Fprintf(b, "%q", v)
+		default:
+			fmt.Fprint(b, v)
+		}
 	}
-	l.error.Println(data...)
+	s.out.Println(b.String())
 }
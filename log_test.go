@@ -16,87 +16,120 @@
 
 package libmqtt
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type testLogEntry struct {
+	level  LogLevel
+	msg    string
+	fields []LogField
+}
+
+type testLogger struct {
+	entries []testLogEntry
+}
+
+func (t *testLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	t.entries = append(t.entries, testLogEntry{level: level, msg: msg, fields: fields})
+}
+
+func logAll(l *logger) {
+	l.v("verbose")
+	l.d("debug")
+	l.i("info")
+	l.w("warning")
+	l.e("error")
+}
 
 func Test_SilentLogger(t *testing.T) {
-	if l := newLogger(Silent); l != nil {
-		t.Error("failed at silent logger")
-	} else {
-		l.v("verbose")
-		l.d("debug")
-		l.i("info")
-		l.w("warning")
-		l.e("error")
+	logAll(nil)
+
+	out := &testLogger{}
+	logAll(&logger{level: Silent, out: out})
+	if len(out.entries) != 0 {
+		t.Error("silent logger should log nothing")
 	}
 }
 
-func Test_ErrorLogger(t *testing.T) {
-	if l := newLogger(Error); l == nil ||
-		l.error == nil || l.warning != nil ||
-		l.info != nil || l.debug != nil || l.verbose != nil {
-		t.Error("failed at error logger")
-	} else {
-		l.v("verbose")
-		l.d("debug")
-		l.i("info")
-		l.w("warning")
-		l.e("error")
+func TestLogger_Levels(t *testing.T) {
+	for level, count := range map[LogLevel]int{
+		Error:   1,
+		Warning: 2,
+		Info:    3,
+		Debug:   4,
+		Verbose: 5,
+	} {
+		out := &testLogger{}
+		logAll(&logger{level: level, out: out})
+		if len(out.entries) != count {
+			t.Errorf("logger with level %d logged %d messages, target = %d", level, len(out.entries), count)
+		}
+
+		for _, e := range out.entries {
+			if e.level < level {
+				t.Errorf("logger with level %d logged message with level %d", level, e.level)
+			}
+		}
 	}
 }
 
-func Test_WarningLogger(t *testing.T) {
-	if l := newLogger(Warning); l == nil ||
-		l.error == nil || l.warning == nil ||
-		l.info != nil || l.debug != nil || l.verbose != nil {
-		t.Error("failed at warning logger")
-	} else {
-		l.v("verbose")
-		l.d("debug")
-		l.i("info")
-		l.w("warning")
-		l.e("error")
+func TestLogger_Redaction(t *testing.T) {
+	out := &testLogger{}
+	l := &logger{level: Verbose, out: out, redact: RedactCredentials | RedactPayload}
+	l.v("test",
+		logField(LogKeyUsername, "user"),
+		logField(LogKeyPassword, "pass"),
+		logPayload([]byte("secret")),
+		logTopic("foo"))
+
+	fields := out.entries[0].fields
+	for _, f := range fields[:3] {
+		if f.Value != redacted {
+			t.Errorf("field %s not redacted, value = %v", f.Key, f.Value)
+		}
 	}
-}
 
-func Test_InfoLogger(t *testing.T) {
-	if l := newLogger(Info); l == nil ||
-		l.error == nil || l.warning == nil ||
-		l.info == nil || l.debug != nil || l.verbose != nil {
-		t.Error("failed at info logger")
-	} else {
-		l.v("verbose")
-		l.d("debug")
-		l.i("info")
-		l.w("warning")
-		l.e("error")
+	if fields[3].Value != "foo" {
+		t.Error("topic should not be redacted")
 	}
 }
 
-func Test_DebugLogger(t *testing.T) {
-	if l := newLogger(Debug); l == nil ||
-		l.error == nil || l.warning == nil ||
-		l.info == nil || l.debug == nil || l.verbose != nil {
-		t.Error("failed at debug logger")
-	} else {
-		l.v("verbose")
-		l.d("debug")
-		l.i("info")
-		l.w("warning")
-		l.e("error")
+func TestLogger_Options(t *testing.T) {
+	out := &testLogger{}
+	c, err := NewClient(WithServer("localhost:1883"), WithLogger(out), WithLog(Info), WithLogRedaction(RedactPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.log.d("debug")
+	c.log.i("info", logPayload([]byte("secret")))
+	if len(out.entries) != 1 || out.entries[0].fields[0].Value != redacted {
+		t.Errorf("unexpected log entries %+v", out.entries)
 	}
 
+	if c, _ = NewClient(WithServer("localhost:1883"), WithLogger(out)); c.log.level != Silent {
+		t.Error("log level should not be changed by logger")
+	}
+
+	out = &testLogger{}
+	c, _ = NewClient(WithServer("localhost:1883"), WithLogger(out), WithLog(Verbose))
+	c.log.v("verbose", logField(LogKeyUsername, "user"), logPayload([]byte("secret")))
+	for _, f := range out.entries[0].fields {
+		if f.Value != redacted {
+			t.Errorf("field %s not redacted by default, value = %v", f.Key, f.Value)
+		}
+	}
 }
 
-func Test_VerboseLogger(t *testing.T) {
-	if l := newLogger(Verbose); l == nil ||
-		l.error == nil || l.warning == nil ||
-		l.info == nil || l.debug == nil || l.verbose == nil {
-		t.Error("failed at verbose logger")
-	} else {
-		l.v("verbose")
-		l.d("debug")
-		l.i("info")
-		l.w("warning")
-		l.e("error")
+func TestStdLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	newStdLogger(buf).Log(Debug, "NET received publish", logTopic("foo"), logID(1), logPayload([]byte("bar")))
+
+	line := buf.String()
+	if !strings.Contains(line, `[LIBMQTT] D NET received publish topic=foo id=1 payload="bar"`) {
+		t.Errorf("unexpected log line %q", line)
 	}
 }
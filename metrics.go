@@ -0,0 +1,120 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libmqtt
+
+import (
+	"bufio"
+	"time"
+)
+
+// Metrics collects the measurements of client internals,
+// all methods are called synchronously in client workers,
+// so implementations MUST be safe for concurrent use and return quickly
+type Metrics interface {
+	// PacketSent is called after a packet with encoded size
+	// was written to the server
+	PacketSent(server string, t CtrlType, size int)
+
+	// PacketRecv is called after a packet with encoded size
+	// was received from the server
+	PacketRecv(server string, t CtrlType, size int)
+
+	// Inflight is called when the count of QoS 1 or QoS 2 publish packets
+	// waiting for acknowledgement changed
+	Inflight(qos QosLevel, count int)
+
+	// QueueDepth reports the count of packets buffered in
+	// the send and recv channel of the client
+	QueueDepth(send, recv int)
+
+	// PersistError is called when the persist method failed
+	PersistError(err error)
+
+	// Reconnect is called before every reconnect attempt to the server
+	Reconnect(server string)
+
+	// AckLatency is called when the server acknowledged a packet sent by
+	// client, t is the type of the acknowledgement packet (PubAck, PubComp,
+	// SubAck, UnSubAck)
+	AckLatency(server string, t CtrlType, latency time.Duration)
+
+	// Throttled is called when a publish packet was delayed or dropped
+	// by rate limit (see `WithRateLimit`)
+	Throttled(topic string, dropped bool, size int)
+}
+
+// noneMetrics drops all measurements, it's the default metrics of client
+type noneMetrics struct{}
+
+func (n *noneMetrics) PacketSent(server string, t CtrlType, size int)              {}
+func (n *noneMetrics) PacketRecv(server string, t CtrlType, size int)              {}
+func (n *noneMetrics) Inflight(qos QosLevel, count int)                            {}
+func (n *noneMetrics) QueueDepth(send, recv int)                                   {}
+func (n *noneMetrics) PersistError(err error)                                      {}
+func (n *noneMetrics) Reconnect(server string)                                     {}
+func (n *noneMetrics) AckLatency(server string, t CtrlType, latency time.Duration) {}
+func (n *noneMetrics) Throttled(topic string, dropped bool, size int)              {}
+
+// countingRW is the buffered connection which counts bytes read and written,
+// read and write are used in different goroutines, so no lock required
+type countingRW struct {
+	*bufio.ReadWriter
+	nRead  int
+	nWrite int
+}
+
+func (c *countingRW) Read(p []byte) (int, error) {
+	n, err := c.ReadWriter.Read(p)
+	c.nRead += n
+	return n, err
+}
+
+func (c *countingRW) ReadByte() (byte, error) {
+	b, err := c.ReadWriter.ReadByte()
+	if err == nil {
+		c.nRead++
+	}
+	return b, err
+}
+
+func (c *countingRW) Write(p []byte) (int, error) {
+	n, err := c.ReadWriter.Write(p)
+	c.nWrite += n
+	return n, err
+}
+
+func (c *countingRW) WriteByte(b byte) error {
+	err := c.ReadWriter.WriteByte(b)
+	if err == nil {
+		c.nWrite++
+	}
+	return err
+}
+
+// takeRead returns bytes read since last call
+func (c *countingRW) takeRead() int {
+	n := c.nRead
+	c.nRead = 0
+	return n
+}
+
+// takeWrite returns bytes written since last call
+func (c *countingRW) takeWrite() int {
+	n := c.nWrite
+	c.nWrite = 0
+	return n
+}
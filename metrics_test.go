@@ -0,0 +1,112 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libmqtt
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	noneMetrics
+
+	mu       sync.Mutex
+	sent     map[CtrlType]int
+	recv     map[CtrlType]int
+	inflight []int
+	acked    map[CtrlType]int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{
+		sent:  make(map[CtrlType]int),
+		recv:  make(map[CtrlType]int),
+		acked: make(map[CtrlType]int),
+	}
+}
+
+func (m *testMetrics) PacketSent(server string, t CtrlType, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent[t] += size
+}
+
+func (m *testMetrics) PacketRecv(server string, t CtrlType, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recv[t] += size
+}
+
+func (m *testMetrics) Inflight(qos QosLevel, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inflight = append(m.inflight, count)
+}
+
+func (m *testMetrics) AckLatency(server string, t CtrlType, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acked[t]++
+}
+
+func TestAsyncClient_Metrics(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	m := newTestMetrics()
+	c, err := NewClient(WithServer(b.addr()), WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := make(chan error, 1)
+	c.HandlePub(func(topic string, err error) {
+		published <- err
+	})
+
+	connectTestClient(t, c)
+	pub := &PublishPacket{TopicName: "foo", Qos: Qos1, Payload: []byte("bar")}
+	c.Publish(pub)
+
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish timeout")
+	}
+	c.Destroy(true)
+	c.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sent[CtrlPublish] != len(pub.Bytes()) {
+		t.Errorf("publish bytes sent = %d, target = %d", m.sent[CtrlPublish], len(pub.Bytes()))
+	}
+
+	if m.sent[CtrlConn] == 0 || m.recv[CtrlConnAck] != 4 || m.recv[CtrlPubAck] != 4 {
+		t.Errorf("unexpected packet bytes, sent = %v, recv = %v", m.sent, m.recv)
+	}
+
+	if m.acked[CtrlPubAck] != 1 {
+		t.Error("ack latency of PubAck not reported")
+	}
+
+	if len(m.inflight) != 2 || m.inflight[0] != 1 || m.inflight[1] != 0 {
+		t.Errorf("unexpected inflight counts %v", m.inflight)
+	}
+}
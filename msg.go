@@ -24,6 +24,7 @@ const (
 	unSubMsg
 	netMsg
 	persistMsg
+	dispatchMsg
 )
 
 type message struct {
@@ -76,3 +77,11 @@ func notifyPersistMsg(ch chan<- *message, err error) {
 		err:  err,
 	}
 }
+
+func notifyDispatchMsg(ch chan<- *message, topic string, err error) {
+	ch <- &message{
+		what: dispatchMsg,
+		msg:  topic,
+		err:  err,
+	}
+}
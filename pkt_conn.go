@@ -83,7 +83,7 @@ func (c *ConnPacket) WriteTo(w BufferedWriter) error {
 		propLen := len(props)
 		payload := c.payload()
 
-		if err := writeVarInt(len(payload)+propLen+10, w); err != nil {
+		if err := writeVarInt(len(payload)+varIntLen(propLen)+propLen+10, w); err != nil {
 			return err
 		}
 		w.Write(mqtt)
@@ -243,7 +243,7 @@ func (c *ConnProps) props() []byte {
 	}
 
 	if c.UserProps != nil {
-		c.UserProps.encodeTo(result)
+		result = c.UserProps.encodeTo(result)
 	}
 
 	if c.AuthMethod != "" {
@@ -344,7 +344,7 @@ func (c *ConnAckPacket) WriteTo(w BufferedWriter) error {
 		props := c.Props.props()
 		propLen := len(props)
 
-		if err := writeVarInt(propLen+2, w); err != nil {
+		if err := writeVarInt(varIntLen(propLen)+propLen+2, w); err != nil {
 			return err
 		}
 
@@ -489,19 +489,22 @@ func (c *ConnAckProps) props() []byte {
 	}
 
 	if c.UserProps != nil {
-		c.UserProps.encodeTo(result)
+		result = c.UserProps.encodeTo(result)
 	}
 
-	if c.WildcardSubAvail {
-		result = append(result, propKeyWildcardSubAvail, 1)
+	// absent means available
+	if !c.WildcardSubAvail {
+		result = append(result, propKeyWildcardSubAvail, 0)
 	}
 
-	if c.SubIDAvail {
-		result = append(result, propKeySubIDAvail, 1)
+	// absent means available
+	if !c.SubIDAvail {
+		result = append(result, propKeySubIDAvail, 0)
 	}
 
-	if c.SharedSubAvail {
-		result = append(result, propKeySharedSubAvail, 1)
+	// absent means available
+	if !c.SharedSubAvail {
+		result = append(result, propKeySharedSubAvail, 0)
 	}
 
 	if c.ServerKeepalive != 0 {
@@ -570,10 +573,20 @@ func (c *ConnAckProps) setProps(props map[byte][]byte) {
 		c.UserProps = getUserProps(v)
 	}
 
+	// absent means available
+	c.WildcardSubAvail, c.SubIDAvail, c.SharedSubAvail = true, true, true
 	if v, ok := props[propKeyWildcardSubAvail]; ok && len(v) == 1 {
 		c.WildcardSubAvail = v[0] == 1
 	}
 
+	if v, ok := props[propKeySubIDAvail]; ok && len(v) == 1 {
+		c.SubIDAvail = v[0] == 1
+	}
+
+	if v, ok := props[propKeySharedSubAvail]; ok && len(v) == 1 {
+		c.SharedSubAvail = v[0] == 1
+	}
+
 	if v, ok := props[propKeyServerKeepalive]; ok {
 		c.ServerKeepalive = getUint16(v)
 	}
@@ -683,7 +696,7 @@ func (d *DisConnProps) props() []byte {
 	}
 
 	if d.UserProps != nil {
-		d.UserProps.encodeTo(result)
+		result = d.UserProps.encodeTo(result)
 	}
 
 	if d.ServerRef != "" {
@@ -153,7 +153,16 @@ func TestConnAckProps_Props(t *testing.T) {
 }
 
 func TestConnAckProps_SetProps(t *testing.T) {
+	p := &ConnAckProps{}
+	p.setProps(map[byte][]byte{})
+	if !p.WildcardSubAvail || !p.SubIDAvail || !p.SharedSubAvail {
+		t.Errorf("absent availability should be true, props = %+v", p)
+	}
 
+	p.setProps(map[byte][]byte{propKeySubIDAvail: {0}, propKeySharedSubAvail: {0}})
+	if !p.WildcardSubAvail || p.SubIDAvail || p.SharedSubAvail {
+		t.Errorf("unexpected availability, props = %+v", p)
+	}
 }
 
 func TestDisConnPacket_Bytes(t *testing.T) {
@@ -170,3 +179,59 @@ func TestDisConnProps_Props(t *testing.T) {
 func TestDisConnProps_SetProps(t *testing.T) {
 
 }
+
+func TestConnPacket_V5Props(t *testing.T) {
+	pkt := &ConnPacket{
+		BasePacket:   BasePacket{ProtoVersion: V5},
+		ClientID:     testClientID,
+		CleanSession: true,
+		Keepalive:    testKeepalive,
+		Props: &ConnProps{
+			ReqRespInfo: true,
+			UserProps:   UserProps{"foo": {"bar"}},
+		},
+	}
+
+	decoded, err := Decode(V5, bytes.NewReader(pkt.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := decoded.(*ConnPacket)
+	if p.Version() != V5 {
+		t.Errorf("protocol version = %d, target = %d", p.Version(), V5)
+	}
+	if p.ClientID != testClientID || p.Keepalive != testKeepalive {
+		t.Errorf("decoded packet = %#v", p)
+	}
+	if !p.Props.ReqRespInfo {
+		t.Error("request response info not decoded")
+	}
+	if v := p.Props.UserProps["foo"]; len(v) != 1 || v[0] != "bar" {
+		t.Errorf("user property foo = %q", v)
+	}
+}
+
+func TestConnAckPacket_V5Props(t *testing.T) {
+	pkt := &ConnAckPacket{
+		BasePacket: BasePacket{ProtoVersion: V5},
+		Present:    true,
+		Props: &ConnAckProps{
+			AssignedClientID: "assigned",
+			UserProps:        UserProps{"foo": {"bar"}},
+		},
+	}
+
+	decoded, err := Decode(V5, bytes.NewReader(pkt.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := decoded.(*ConnAckPacket)
+	if !p.Present || p.Props.AssignedClientID != "assigned" {
+		t.Errorf("decoded packet = %#v", p)
+	}
+	if v := p.Props.UserProps["foo"]; len(v) != 1 || v[0] != "bar" {
+		t.Errorf("user property foo = %q", v)
+	}
+}
@@ -63,16 +63,17 @@ func (p *PublishPacket) WriteTo(w BufferedWriter) error {
 
 		props := p.Props.props()
 		propLen := len(props)
-		payload := p.payload()
+		header := p.variableHeader()
 
-		if err := writeVarInt(len(payload)+propLen, w); err != nil {
+		if err := writeVarInt(len(header)+varIntLen(propLen)+propLen+len(p.Payload), w); err != nil {
 			return err
 		}
 
+		w.Write(header)
 		writeVarInt(propLen, w)
 		w.Write(props)
 
-		_, err := w.Write(payload)
+		_, err := w.Write(p.Payload)
 		return err
 	default:
 		return ErrUnsupportedVersion
@@ -80,11 +81,16 @@ func (p *PublishPacket) WriteTo(w BufferedWriter) error {
 }
 
 func (p *PublishPacket) payload() []byte {
+	return append(p.variableHeader(), p.Payload...)
+}
+
+// variableHeader is the topic name and packet id (if any)
+func (p *PublishPacket) variableHeader() []byte {
 	data := encodeStringWithLen(p.TopicName)
 	if p.Qos > Qos0 {
 		data = append(data, byte(p.PacketID>>8), byte(p.PacketID))
 	}
-	return append(data, p.Payload...)
+	return data
 }
 
 // PublishProps properties for PublishPacket
@@ -143,7 +149,7 @@ func (p *PublishProps) props() []byte {
 	}
 
 	if p.TopicAlias != 0 {
-		data := []byte{propKeyTopicAlias, 0, 0, 0, 0}
+		data := []byte{propKeyTopicAlias, 0, 0}
 		putUint16(data[1:], p.TopicAlias)
 		result = append(result, data...)
 	}
@@ -159,7 +165,7 @@ func (p *PublishProps) props() []byte {
 	}
 
 	if p.UserProps != nil {
-		p.UserProps.encodeTo(result)
+		result = p.UserProps.encodeTo(result)
 	}
 
 	if p.SubIDs != nil {
@@ -180,6 +186,14 @@ func (p *PublishProps) props() []byte {
 	return result
 }
 
+// userProps returns user properties, nil if p is nil
+func (p *PublishProps) userProps() UserProps {
+	if p == nil {
+		return nil
+	}
+	return p.UserProps
+}
+
 func (p *PublishProps) setProps(props map[byte][]byte) {
 	if p == nil || props == nil {
 		return
@@ -259,24 +273,35 @@ func (p *PubAckPacket) WriteTo(w BufferedWriter) error {
 		w.WriteByte(byte(p.PacketID >> 8))
 		return w.WriteByte(byte(p.PacketID))
 	case V5:
-		w.WriteByte(byte(CtrlPubAck << 4))
-
-		props := p.Props.props()
-		propLen := len(props)
-		if err := writeVarInt(propLen+2, w); err != nil {
-			return err
-		}
+		return writeAckV5(w, byte(CtrlPubAck<<4), p.PacketID, p.Code, p.Props.props())
+	default:
+		return ErrUnsupportedVersion
+	}
+}
 
-		w.WriteByte(byte(p.PacketID >> 8))
-		w.WriteByte(byte(p.PacketID))
+// writeAckV5 writes the MQTT 5 acknowledgement packet of publish flow
+// (PubAck, PubRecv, PubRel, PubComp), reason code and properties can be
+// omitted when the reason code is success and there are no properties
+func writeAckV5(w BufferedWriter, header byte, packetID uint16, code byte, props []byte) error {
+	w.WriteByte(header)
 
-		writeVarInt(propLen, w)
-		_, err := w.Write(props)
+	if code == CodeSuccess && len(props) == 0 {
+		w.WriteByte(2)
+		w.WriteByte(byte(packetID >> 8))
+		return w.WriteByte(byte(packetID))
+	}
 
+	if err := writeVarInt(3+varIntLen(len(props))+len(props), w); err != nil {
 		return err
-	default:
-		return ErrUnsupportedVersion
 	}
+
+	w.WriteByte(byte(packetID >> 8))
+	w.WriteByte(byte(packetID))
+	w.WriteByte(code)
+	writeVarInt(len(props), w)
+
+	_, err := w.Write(props)
+	return err
 }
 
 // PubAckProps properties for PubAckPacket
@@ -300,7 +325,7 @@ func (p *PubAckProps) props() []byte {
 	}
 
 	if p.UserProps != nil {
-		p.UserProps.encodeTo(result)
+		result = p.UserProps.encodeTo(result)
 	}
 	return result
 }
@@ -355,21 +380,7 @@ func (p *PubRecvPacket) WriteTo(w BufferedWriter) error {
 		w.WriteByte(byte(p.PacketID >> 8))
 		return w.WriteByte(byte(p.PacketID))
 	case V5:
-		w.WriteByte(byte(CtrlPubRecv << 4))
-
-		props := p.Props.props()
-		propLen := len(props)
-		if err := writeVarInt(propLen+2, w); err != nil {
-			return err
-		}
-
-		w.WriteByte(byte(p.PacketID >> 8))
-		w.WriteByte(byte(p.PacketID))
-
-		writeVarInt(propLen, w)
-		_, err := w.Write(props)
-
-		return err
+		return writeAckV5(w, byte(CtrlPubRecv<<4), p.PacketID, p.Code, p.Props.props())
 	default:
 		return ErrUnsupportedVersion
 	}
@@ -395,7 +406,7 @@ func (p *PubRecvProps) props() []byte {
 	}
 
 	if p.UserProps != nil {
-		p.UserProps.encodeTo(result)
+		result = p.UserProps.encodeTo(result)
 	}
 	return result
 }
@@ -450,21 +461,7 @@ func (p *PubRelPacket) WriteTo(w BufferedWriter) error {
 		w.WriteByte(byte(p.PacketID >> 8))
 		return w.WriteByte(byte(p.PacketID))
 	case V5:
-		w.WriteByte(byte(CtrlPubRel<<4 | 0x02))
-
-		props := p.Props.props()
-		propLen := len(props)
-		if err := writeVarInt(propLen+2, w); err != nil {
-			return err
-		}
-
-		w.WriteByte(byte(p.PacketID >> 8))
-		w.WriteByte(byte(p.PacketID))
-
-		writeVarInt(propLen, w)
-		_, err := w.Write(props)
-
-		return err
+		return writeAckV5(w, byte(CtrlPubRel<<4|0x02), p.PacketID, p.Code, p.Props.props())
 	default:
 		return ErrUnsupportedVersion
 	}
@@ -491,7 +488,7 @@ func (p *PubRelProps) props() []byte {
 	}
 
 	if p.UserProps != nil {
-		p.UserProps.encodeTo(result)
+		result = p.UserProps.encodeTo(result)
 	}
 	return result
 }
@@ -546,21 +543,7 @@ func (p *PubCompPacket) WriteTo(w BufferedWriter) error {
 		w.WriteByte(byte(p.PacketID >> 8))
 		return w.WriteByte(byte(p.PacketID))
 	case V5:
-		w.WriteByte(byte(CtrlPubComp << 4))
-
-		props := p.Props.props()
-		propLen := len(props)
-		if err := writeVarInt(propLen+2, w); err != nil {
-			return err
-		}
-
-		w.WriteByte(byte(p.PacketID >> 8))
-		w.WriteByte(byte(p.PacketID))
-
-		writeVarInt(propLen, w)
-		_, err := w.Write(props)
-
-		return err
+		return writeAckV5(w, byte(CtrlPubComp<<4), p.PacketID, p.Code, p.Props.props())
 	default:
 		return ErrUnsupportedVersion
 	}
@@ -586,7 +569,7 @@ func (p *PubCompProps) props() []byte {
 	}
 
 	if p.UserProps != nil {
-		p.UserProps.encodeTo(result)
+		result = p.UserProps.encodeTo(result)
 	}
 	return result
 }
@@ -116,7 +116,39 @@ func TestPublishPacket_Bytes(t *testing.T) {
 }
 
 func TestPubProps_Props(t *testing.T) {
+	pkt := &PublishPacket{
+		BasePacket: BasePacket{ProtoVersion: V5},
+		TopicName:  "foo",
+		Qos:        Qos1,
+		PacketID:   testPacketID,
+		Payload:    []byte("bar"),
+		Props: &PublishProps{
+			TopicAlias: 10,
+			UserProps:  UserProps{"foo": {"bar", "baz"}},
+		},
+	}
+
+	decoded, err := Decode(V5, bytes.NewReader(pkt.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := decoded.(*PublishPacket)
+	if !ok || p.Props == nil {
+		t.Fatalf("decoded packet %#v has no props", decoded)
+	}
+
+	if p.Props.TopicAlias != 10 {
+		t.Errorf("topic alias = %d, target = 10", p.Props.TopicAlias)
+	}
 
+	if v := p.Props.UserProps["foo"]; len(v) != 2 || v[0] != "bar" || v[1] != "baz" {
+		t.Errorf("user property foo = %q", v)
+	}
+
+	if p.TopicName != "foo" || p.PacketID != testPacketID || string(p.Payload) != "bar" {
+		t.Errorf("decoded packet = %#v", p)
+	}
 }
 
 func TestPubProps_SetProps(t *testing.T) {
@@ -182,3 +214,56 @@ func TestPubCompProps_Props(t *testing.T) {
 func TestPubCompProps_SetProps(t *testing.T) {
 
 }
+
+func TestPubAckPackets_V5(t *testing.T) {
+	packets := []Packet{
+		&PubAckPacket{PacketID: testPacketID, Props: &PubAckProps{}},
+		&PubRecvPacket{PacketID: testPacketID, Props: &PubRecvProps{}},
+		&PubRelPacket{PacketID: testPacketID, Props: &PubRelProps{}},
+		&PubCompPacket{PacketID: testPacketID, Props: &PubCompProps{}},
+	}
+
+	for _, pkt := range packets {
+		pkt.(interface{ setVersion(ProtoVersion) }).setVersion(V5)
+
+		// reason code and properties omitted on success
+		data := pkt.Bytes()
+		if len(data) != 4 || data[1] != 2 {
+			t.Errorf("packet type %d encoded as %v", pkt.Type(), data)
+		}
+
+		decoded, err := Decode(V5, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Type() != pkt.Type() {
+			t.Errorf("decoded packet type = %d, target = %d", decoded.Type(), pkt.Type())
+		}
+	}
+
+	pkt := &PubAckPacket{
+		BasePacket: BasePacket{ProtoVersion: V5},
+		PacketID:   testPacketID,
+		Code:       0x10,
+		Props: &PubAckProps{
+			Reason:    "no matching subscribers",
+			UserProps: UserProps{"foo": {"bar"}},
+		},
+	}
+
+	decoded, err := Decode(V5, bytes.NewReader(pkt.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := decoded.(*PubAckPacket)
+	if p.PacketID != testPacketID || p.Code != 0x10 {
+		t.Errorf("decoded packet id = %d, code = %d", p.PacketID, p.Code)
+	}
+	if p.Props.Reason != pkt.Props.Reason {
+		t.Errorf("reason = %q, target = %q", p.Props.Reason, pkt.Props.Reason)
+	}
+	if v := p.Props.UserProps["foo"]; len(v) != 1 || v[0] != "bar" {
+		t.Errorf("user property foo = %q", v)
+	}
+}
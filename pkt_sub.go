@@ -71,7 +71,7 @@ func (s *SubscribePacket) WriteTo(w BufferedWriter) error {
 		payload := s.payload()
 		propLen := len(props)
 
-		if err := writeVarInt(len(payload)+propLen+2, w); err != nil {
+		if err := writeVarInt(len(payload)+varIntLen(propLen)+propLen+2, w); err != nil {
 			return err
 		}
 
@@ -93,7 +93,11 @@ func (s *SubscribePacket) payload() []byte {
 	if s.Topics != nil {
 		for _, t := range s.Topics {
 			result = append(result, encodeStringWithLen(t.Name)...)
-			result = append(result, t.Qos)
+			if s.ProtoVersion == V5 {
+				result = append(result, t.subOptions())
+			} else {
+				result = append(result, t.Qos)
+			}
 		}
 	}
 	return result
@@ -122,7 +126,7 @@ func (s *SubscribeProps) props() []byte {
 	}
 
 	if s.UserProps != nil {
-		s.UserProps.encodeTo(result)
+		result = s.UserProps.encodeTo(result)
 	}
 	return result
 }
@@ -193,7 +197,7 @@ func (s *SubAckPacket) WriteTo(w BufferedWriter) error {
 		payload := s.payload()
 		propLen := len(props)
 
-		if err := writeVarInt(len(payload)+propLen+2, w); err != nil {
+		if err := writeVarInt(len(payload)+varIntLen(propLen)+propLen+2, w); err != nil {
 			return err
 		}
 
@@ -235,7 +239,7 @@ func (p *SubAckProps) props() []byte {
 	}
 
 	if p.UserProps != nil {
-		p.UserProps.encodeTo(result)
+		result = p.UserProps.encodeTo(result)
 	}
 	return result
 }
@@ -300,7 +304,7 @@ func (s *UnSubPacket) WriteTo(w BufferedWriter) error {
 		payload := s.payload()
 		propLen := len(props)
 
-		if err := writeVarInt(len(payload)+propLen+2, w); err != nil {
+		if err := writeVarInt(len(payload)+varIntLen(propLen)+propLen+2, w); err != nil {
 			return err
 		}
 
@@ -339,7 +343,7 @@ func (p *UnSubProps) props() []byte {
 	}
 	result := make([]byte, 0)
 	if p.UserProps != nil {
-		p.UserProps.encodeTo(result)
+		result = p.UserProps.encodeTo(result)
 	}
 	return result
 }
@@ -389,13 +393,18 @@ func (s *UnSubAckPacket) WriteTo(w BufferedWriter) error {
 		w.WriteByte(byte(s.PacketID >> 8))
 		return w.WriteByte(byte(s.PacketID))
 	case V5:
+		props := s.Props.props()
+		propLen := len(props)
+
 		w.WriteByte(byte(CtrlUnSubAck << 4))
-		w.WriteByte(0x02)
+		if err := writeVarInt(varIntLen(propLen)+propLen+2, w); err != nil {
+			return err
+		}
+
 		w.WriteByte(byte(s.PacketID >> 8))
 		w.WriteByte(byte(s.PacketID))
 
-		props := s.Props.props()
-		writeVarInt(len(props), w)
+		writeVarInt(propLen, w)
 		_, err := w.Write(props)
 		return err
 	default:
@@ -423,7 +432,7 @@ func (p *UnSubAckProps) props() []byte {
 	}
 
 	if p.UserProps != nil {
-		p.UserProps.encodeTo(result)
+		result = p.UserProps.encodeTo(result)
 	}
 	return result
 }
@@ -136,3 +136,61 @@ func TestUnSubAckPacket_Bytes(t *testing.T) {
 	// testUnSubAckMsg.ProtoVersion = V5
 	// testPacketBytes(testUnSubAckMsg, testUnSubAckMsgBytesV5, t)
 }
+
+func TestUnSubAckPacket_V5Props(t *testing.T) {
+	pkt := &UnSubAckPacket{
+		BasePacket: BasePacket{ProtoVersion: V5},
+		PacketID:   testPacketID,
+		Props: &UnSubAckProps{
+			UserProps: UserProps{"foo": {"bar"}},
+		},
+	}
+
+	decoded, err := Decode(V5, bytes.NewReader(pkt.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := decoded.(*UnSubAckPacket)
+	if p.PacketID != testPacketID {
+		t.Errorf("packet id = %d, target = %d", p.PacketID, testPacketID)
+	}
+	if v := p.Props.UserProps["foo"]; len(v) != 1 || v[0] != "bar" {
+		t.Errorf("user property foo = %q", v)
+	}
+}
+
+func TestSubscribePacket_SubOptions(t *testing.T) {
+	topic := &Topic{Name: "foo", Qos: Qos1, NoLocal: true, RetainAsPublished: true, RetainHandling: RetainNoSend}
+	pkt := &SubscribePacket{
+		BasePacket: BasePacket{ProtoVersion: V5},
+		PacketID:   testPacketID,
+		Topics:     []*Topic{topic},
+	}
+
+	data := pkt.Bytes()
+	if opts := data[len(data)-1]; opts != 0x2D {
+		t.Errorf("subscription options = %#x, target = 0x2d", opts)
+	}
+
+	decoded, err := Decode(V5, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := decoded.(*SubscribePacket)
+	if !ok || len(p.Topics) != 1 {
+		t.Fatalf("unexpected decoded packet %#v", decoded)
+	}
+
+	if *p.Topics[0] != *topic {
+		t.Errorf("decoded topic = %+v, target = %+v", p.Topics[0], topic)
+	}
+
+	// mqtt 3.1.1 carries qos only
+	pkt.ProtoVersion = V311
+	data = pkt.Bytes()
+	if opts := data[len(data)-1]; opts != Qos1 {
+		t.Errorf("subscription options = %#x, target = %#x", opts, Qos1)
+	}
+}
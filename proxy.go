@@ -0,0 +1,319 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+var (
+	// ErrUnsupportedProxy is the error when proxy scheme is not one of
+	// http, https, socks5 and socks5h
+	ErrUnsupportedProxy = errors.New("proxy scheme not supported ")
+)
+
+// ProxyFunc returns the proxy for server address (host:port),
+// nil proxy means connect directly
+type ProxyFunc func(address string) (*url.URL, error)
+
+// FixedProxy returns ProxyFunc using the proxy for all servers
+func FixedProxy(proxy *url.URL) ProxyFunc {
+	return func(string) (*url.URL, error) {
+		return proxy, nil
+	}
+}
+
+// ProxyFromEnvironment returns ProxyFunc using the proxy indicated by
+// environment variables HTTPS_PROXY and ALL_PROXY (or the lowercase
+// versions), servers matching NO_PROXY (or no_proxy) are connected
+// directly, so are loopback addresses
+func ProxyFromEnvironment() ProxyFunc {
+	proxy := getEnvAny("HTTPS_PROXY", "https_proxy")
+	if proxy == "" {
+		proxy = getEnvAny("ALL_PROXY", "all_proxy")
+	}
+
+	proxyFor := (&httpproxy.Config{
+		HTTPSProxy: proxy,
+		NoProxy:    getEnvAny("NO_PROXY", "no_proxy"),
+	}).ProxyFunc()
+
+	return func(address string) (*url.URL, error) {
+		return proxyFor(&url.URL{Scheme: "https", Host: address})
+	}
+}
+
+func getEnvAny(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// NewProxyDialer creates a dialer connecting to servers through proxies
+// returned by proxy, forward is used to connect to the proxy servers
+//
+// supported proxy schemes are http and https (HTTP CONNECT), socks5
+// and socks5h (SOCKS5), credentials are taken from the user info of
+// proxy url
+func NewProxyDialer(proxy ProxyFunc, forward Dialer) Dialer {
+	return &proxyDialer{proxy: proxy, forward: forward}
+}
+
+type proxyDialer struct {
+	proxy   ProxyFunc
+	forward Dialer
+}
+
+// DialContext connects to address through proxy,
+// only tcp network is proxied
+func (d *proxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != "tcp" {
+		return d.forward.DialContext(ctx, network, address)
+	}
+
+	proxy, err := d.proxy(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxy == nil {
+		return d.forward.DialContext(ctx, network, address)
+	}
+
+	var handshake func(conn net.Conn) (net.Conn, error)
+	switch proxy.Scheme {
+	case "http", "https":
+		handshake = func(conn net.Conn) (net.Conn, error) {
+			return httpConnect(conn, proxy, address)
+		}
+	case "socks5", "socks5h":
+		handshake = func(conn net.Conn) (net.Conn, error) {
+			return conn, socks5Connect(conn, proxy, address)
+		}
+	default:
+		return nil, ErrUnsupportedProxy
+	}
+
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), map[string]string{
+			"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080",
+		}[proxy.Scheme])
+	}
+
+	conn, err := d.forward.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+		if err := honorContext(ctx, nil, tlsConn.Handshake); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	var result net.Conn
+	if err := honorContext(ctx, nil, func() (err error) {
+		result, err = handshake(conn)
+		return err
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+// bufferedConn is the connection with data buffered when reading
+// proxy response
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// httpConnect requests HTTP tunnel to address with CONNECT method
+func httpConnect(conn net.Conn, proxy *url.URL, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+
+	if u := proxy.User; u != nil {
+		password, _ := u.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy CONNECT %s failed: %s", address, resp.Status)
+	}
+
+	if r.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: io.MultiReader(r, conn)}, nil
+	}
+	return conn, nil
+}
+
+// socks5 protocol constants (RFC 1928, RFC 1929)
+const (
+	socks5Version      = 0x05
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5AuthNoAccept = 0xFF
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+)
+
+// socks5Connect requests SOCKS5 proxy to connect to address
+func socks5Connect(conn net.Conn, proxy *url.URL, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 0xFFFF {
+		return errors.New("socks5 invalid port " + portStr)
+	}
+
+	// method negotiation
+	method := byte(socks5AuthNone)
+	if proxy.User != nil {
+		method = socks5AuthPassword
+	}
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5Version || buf[1] == socks5AuthNoAccept || buf[1] != method {
+		return errors.New("socks5 authentication method not accepted")
+	}
+
+	if method == socks5AuthPassword {
+		username := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("socks5 credentials too long")
+		}
+
+		req := []byte{0x01, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		if buf[1] != 0x00 {
+			return errors.New("socks5 authentication failed")
+		}
+	}
+
+	// connect request
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("socks5 host name too long")
+		}
+		req = append(req, socks5AddrDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socks5AddrIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socks5AddrIPv6)
+		req = append(req, ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	// reply: version, reply code, reserved, bound address type
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return errors.New("socks5 unexpected protocol version")
+	}
+	if reply[1] != 0x00 {
+		return errors.New("socks5 connect failed with code " + strconv.Itoa(int(reply[1])))
+	}
+
+	// skip bound address and port
+	var addrLen int
+	switch reply[3] {
+	case socks5AddrIPv4:
+		addrLen = net.IPv4len
+	case socks5AddrIPv6:
+		addrLen = net.IPv6len
+	case socks5AddrDomain:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		addrLen = int(buf[0])
+	default:
+		return errors.New("socks5 unexpected address type")
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, addrLen+2))
+	return err
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// serveTestProxy accepts one connection, calls handshake and then
+// forwards traffic to the test broker
+func serveTestProxy(t *testing.T, b *testBroker, handshake func(conn net.Conn, r *bufio.Reader) bool) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		if !handshake(conn, r) {
+			return
+		}
+
+		upstream, err := net.Dial("tcp", b.addr())
+		if err != nil {
+			return
+		}
+		defer upstream.Close()
+
+		go io.Copy(upstream, r)
+		io.Copy(conn, upstream)
+	}()
+
+	return l
+}
+
+func testProxyConnect(t *testing.T, b *testBroker, proxy string) {
+	c, err := NewClient(WithServer("broker.example.com:1883"), WithProxy(proxy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connectTestClient(t, c)
+	c.Destroy(true)
+	c.Wait()
+}
+
+func TestAsyncClient_HTTPProxy(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	l := serveTestProxy(t, b, func(conn net.Conn, r *bufio.Reader) bool {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return false
+		}
+
+		user, pass, ok := (&http.Request{Header: http.Header{
+			"Authorization": req.Header["Proxy-Authorization"],
+		}}).BasicAuth()
+		if req.Method != http.MethodConnect || req.Host != "broker.example.com:1883" ||
+			!ok || user != "user" || pass != "pass" {
+			t.Errorf("unexpected proxy request %s %s %v", req.Method, req.Host, req.Header)
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return false
+		}
+
+		_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		return err == nil
+	})
+	defer l.Close()
+
+	testProxyConnect(t, b, "http://user:pass@"+l.Addr().String())
+}
+
+func TestAsyncClient_SOCKS5Proxy(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	l := serveTestProxy(t, b, func(conn net.Conn, r *bufio.Reader) bool {
+		// method negotiation
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(r, greeting); err != nil || greeting[2] != socks5AuthPassword {
+			t.Errorf("unexpected socks5 greeting %v", greeting)
+			return false
+		}
+		conn.Write([]byte{socks5Version, socks5AuthPassword})
+
+		// username/password authentication
+		auth := make([]byte, 2+4+1+4)
+		if _, err := io.ReadFull(r, auth); err != nil || string(auth[2:6]) != "user" || string(auth[7:]) != "pass" {
+			t.Errorf("unexpected socks5 authentication %q", auth)
+			return false
+		}
+		conn.Write([]byte{0x01, 0x00})
+
+		// connect request with domain name
+		req := make([]byte, 5)
+		if _, err := io.ReadFull(r, req); err != nil || req[3] != socks5AddrDomain {
+			t.Errorf("unexpected socks5 request %v", req)
+			return false
+		}
+		addr := make([]byte, int(req[4])+2)
+		io.ReadFull(r, addr)
+		if host := string(addr[:len(addr)-2]); host != "broker.example.com" {
+			t.Errorf("socks5 request host = %q", host)
+		}
+
+		_, err := conn.Write([]byte{socks5Version, 0x00, 0x00, socks5AddrIPv4, 127, 0, 0, 1, 0, 0})
+		return err == nil
+	})
+	defer l.Close()
+
+	testProxyConnect(t, b, "socks5://user:pass@"+l.Addr().String())
+}
+
+func TestProxyFromEnvironment(t *testing.T) {
+	for _, k := range []string{"HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy", "NO_PROXY", "no_proxy"} {
+		if v, ok := os.LookupEnv(k); ok {
+			defer os.Setenv(k, v)
+		} else {
+			defer os.Unsetenv(k)
+		}
+		os.Unsetenv(k)
+	}
+
+	os.Setenv("ALL_PROXY", "socks5://proxy.example.com:1080")
+	os.Setenv("NO_PROXY", "internal.example.com")
+
+	proxy := ProxyFromEnvironment()
+	for address, target := range map[string]string{
+		"broker.example.com:8883":   "socks5://proxy.example.com:1080",
+		"internal.example.com:1883": "",
+		"127.0.0.1:1883":            "",
+	} {
+		u, err := proxy(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (u == nil && target != "") || (u != nil && u.String() != target) {
+			t.Errorf("proxy for %s = %v, target = %q", address, u, target)
+		}
+	}
+
+	os.Setenv("HTTPS_PROXY", "http://proxy.example.com:3128")
+	if u, _ := ProxyFromEnvironment()("broker.example.com:8883"); u == nil || u.Host != "proxy.example.com:3128" {
+		t.Errorf("HTTPS_PROXY not preferred, proxy = %v", u)
+	}
+}
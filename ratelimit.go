@@ -0,0 +1,314 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libmqtt
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrPacketThrottled is the error reported to PubHandler when a QoS 0
+	// publish packet was dropped by rate limit
+	ErrPacketThrottled = errors.New("packet dropped by rate limit ")
+)
+
+// RateLimit defines token bucket limits applied to outgoing publish packets
+type RateLimit struct {
+	// TopicPrefix restricts this limit to publish packets whose topic name
+	// starts with it, empty means the limit applies to all publish packets
+	TopicPrefix string
+
+	// MsgRate is the count of messages allowed per second,
+	// 0 means no message rate limit
+	MsgRate float64
+
+	// MsgBurst is the max count of messages can be sent at once,
+	// default value is the MsgRate (at least 1)
+	MsgBurst int
+
+	// ByteRate is the count of bytes of encoded publish packets (before
+	// compression) allowed per second, 0 means no bandwidth limit
+	ByteRate float64
+
+	// ByteBurst is the max count of bytes can be sent at once,
+	// default value is the ByteRate (at least 1)
+	ByteBurst int
+
+	// DropQos0 defines how to tackle with QoS 0 publish packets when limit
+	// is reached, true to drop them (ErrPacketThrottled will be sent to
+	// the PubHandler), false to delay them until the limit allows
+	//
+	// QoS 1 and QoS 2 publish packets are always delayed
+	DropQos0 bool
+}
+
+// ThrottleStats contains counters of outgoing traffic throttled by rate limit
+type ThrottleStats struct {
+	DelayedMsgs  uint64 // count of delayed publish packets
+	DelayedBytes uint64 // bytes of delayed publish packets
+	DroppedMsgs  uint64 // count of dropped publish packets
+	DroppedBytes uint64 // bytes of dropped publish packets
+}
+
+// tokenBucket is a token bucket allowing reservation of tokens in advance,
+// tokens can be negative after reservation
+type tokenBucket struct {
+	rate   float64 // tokens filled per second
+	burst  float64 // bucket capacity
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	b := float64(burst)
+	if b < 1 {
+		b = rate
+		if b < 1 {
+			b = 1
+		}
+	}
+
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: now}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// delay returns the time to wait until n tokens are available
+func (b *tokenBucket) delay(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.advance(now)
+	if b.tokens >= n {
+		return 0
+	}
+
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take n tokens from the bucket
+func (b *tokenBucket) take(now time.Time, n float64) {
+	if b == nil {
+		return
+	}
+
+	b.advance(now)
+	b.tokens -= n
+}
+
+type limitRule struct {
+	prefix   string
+	msg      *tokenBucket
+	bytes    *tokenBucket
+	dropQos0 bool
+	queue    chan *pacedPacket // packets waiting for this rule
+}
+
+// pacedPacket is the publish packet to send at the reserved time
+type pacedPacket struct {
+	p  *PublishPacket
+	at time.Time
+}
+
+// rateLimiter throttles outgoing publish packets of a client
+type rateLimiter struct {
+	rules []*limitRule
+	mu    *sync.Mutex
+	now   func() time.Time
+
+	delayedMsgs  uint64
+	delayedBytes uint64
+	droppedMsgs  uint64
+	droppedBytes uint64
+}
+
+func newRateLimiter(limits []*RateLimit, now func() time.Time) *rateLimiter {
+	l := &rateLimiter{mu: &sync.Mutex{}, now: now}
+
+	t := now()
+	for _, v := range limits {
+		if v == nil {
+			continue
+		}
+
+		r := &limitRule{
+			prefix:   v.TopicPrefix,
+			msg:      newTokenBucket(v.MsgRate, v.MsgBurst, t),
+			bytes:    newTokenBucket(v.ByteRate, v.ByteBurst, t),
+			dropQos0: v.DropQos0,
+		}
+
+		if r.msg != nil || r.bytes != nil {
+			l.rules = append(l.rules, r)
+		}
+	}
+
+	if len(l.rules) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+// init the queue of each rule with size
+func (l *rateLimiter) init(size int) {
+	for _, r := range l.rules {
+		r.queue = make(chan *pacedPacket, size)
+	}
+}
+
+// reserve the quota for publish packet p with encoded size,
+// returns the rule pacing the packet (nil if no rule matched) and the
+// time to wait before sending it, false if the packet should be dropped
+func (l *rateLimiter) reserve(p *PublishPacket, size int) (*limitRule, time.Duration, bool) {
+	if l == nil {
+		return nil, 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	matched := make([]*limitRule, 0, len(l.rules))
+	var (
+		pacer *limitRule
+		delay time.Duration
+		drop  bool
+	)
+	for _, r := range l.rules {
+		if !strings.HasPrefix(p.TopicName, r.prefix) {
+			continue
+		}
+		matched = append(matched, r)
+
+		d := r.msg.delay(now, 1)
+		if bd := r.bytes.delay(now, float64(size)); bd > d {
+			d = bd
+		}
+
+		if d > 0 && r.dropQos0 && p.Qos == Qos0 {
+			drop = true
+		}
+
+		if pacer == nil || d > delay {
+			pacer, delay = r, d
+		}
+	}
+
+	if drop {
+		atomic.AddUint64(&l.droppedMsgs, 1)
+		atomic.AddUint64(&l.droppedBytes, uint64(size))
+		return nil, 0, false
+	}
+
+	for _, r := range matched {
+		r.msg.take(now, 1)
+		r.bytes.take(now, float64(size))
+	}
+
+	if delay > 0 {
+		atomic.AddUint64(&l.delayedMsgs, 1)
+		atomic.AddUint64(&l.delayedBytes, uint64(size))
+	}
+
+	return pacer, delay, true
+}
+
+func (l *rateLimiter) stats() ThrottleStats {
+	if l == nil {
+		return ThrottleStats{}
+	}
+
+	return ThrottleStats{
+		DelayedMsgs:  atomic.LoadUint64(&l.delayedMsgs),
+		DelayedBytes: atomic.LoadUint64(&l.delayedBytes),
+		DroppedMsgs:  atomic.LoadUint64(&l.droppedMsgs),
+		DroppedBytes: atomic.LoadUint64(&l.droppedBytes),
+	}
+}
+
+// handlePace sends the publish packets paced by rule r at their reserved
+// time, packets of other rules and types are never blocked by the delay
+func (c *AsyncClient) handlePace(r *limitRule) {
+	defer c.workers.Done()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case pp := <-r.queue:
+			if delay := pp.at.Sub(c.limiter.now()); delay > 0 {
+				t := time.NewTimer(delay)
+				select {
+				case <-c.ctx.Done():
+					t.Stop()
+					return
+				case <-t.C:
+				}
+			}
+
+			select {
+			case <-c.ctx.Done():
+				return
+			case c.sendCh <- pp.p:
+			}
+		}
+	}
+}
+
+// pace the publish packet according to the rate limit of client, the
+// packet is dropped or queued for its rule at once, and queued for
+// sending directly if no rule matched
+func (c *AsyncClient) pace(p *PublishPacket) {
+	size := len(p.Bytes())
+	r, delay, ok := c.limiter.reserve(p, size)
+	if !ok {
+		c.log.w("CLI publish packet dropped by rate limit", logTopic(p.TopicName))
+		c.metrics.Throttled(p.TopicName, true, size)
+		notifyPubMsg(c.msgCh, p.TopicName, ErrPacketThrottled)
+		return
+	}
+
+	if r == nil {
+		c.sendCh <- p
+		return
+	}
+
+	if delay > 0 {
+		c.log.d("CLI publish packet delayed by rate limit", logTopic(p.TopicName), logField("delay", delay))
+		c.metrics.Throttled(p.TopicName, false, size)
+	}
+
+	r.queue <- &pacedPacket{p: p, at: c.limiter.now().Add(delay)}
+}
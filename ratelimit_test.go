@@ -0,0 +1,185 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libmqtt
+
+import (
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func TestRateLimiter_MsgRate(t *testing.T) {
+	clock := &testClock{t: time.Now()}
+	l := newRateLimiter([]*RateLimit{{MsgRate: 2}}, clock.now)
+
+	pkt := &PublishPacket{TopicName: "foo", Qos: Qos1}
+	for i := 0; i < 2; i++ {
+		if _, d, ok := l.reserve(pkt, 10); !ok || d != 0 {
+			t.Errorf("burst packet %d should not be throttled, delay = %v", i, d)
+		}
+	}
+
+	if _, d, ok := l.reserve(pkt, 10); !ok || d != 500*time.Millisecond {
+		t.Errorf("packet should be delayed 500ms, delay = %v", d)
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if _, d, ok := l.reserve(pkt, 10); !ok || d != 0 {
+		t.Errorf("packet should not be throttled after refill, delay = %v", d)
+	}
+
+	if s := l.stats(); s.DelayedMsgs != 1 || s.DelayedBytes != 10 || s.DroppedMsgs != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestRateLimiter_ByteRateDropQos0(t *testing.T) {
+	clock := &testClock{t: time.Now()}
+	l := newRateLimiter([]*RateLimit{
+		{TopicPrefix: "telemetry/", ByteRate: 100, DropQos0: true},
+	}, clock.now)
+
+	if _, _, ok := l.reserve(&PublishPacket{TopicName: "telemetry/a"}, 80); !ok {
+		t.Error("packet within burst should not be dropped")
+	}
+
+	if _, _, ok := l.reserve(&PublishPacket{TopicName: "telemetry/b"}, 80); ok {
+		t.Error("qos0 packet exceeding limit should be dropped")
+	}
+
+	if _, d, ok := l.reserve(&PublishPacket{TopicName: "command/a"}, 80); !ok || d != 0 {
+		t.Error("packet not matching prefix should not be throttled")
+	}
+
+	if _, d, ok := l.reserve(&PublishPacket{TopicName: "telemetry/c", Qos: Qos1}, 80); !ok || d == 0 {
+		t.Error("qos1 packet exceeding limit should be delayed")
+	}
+
+	if s := l.stats(); s.DroppedMsgs != 1 || s.DroppedBytes != 80 || s.DelayedMsgs != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestRateLimiter_None(t *testing.T) {
+	if l := newRateLimiter([]*RateLimit{nil, {TopicPrefix: "foo"}}, time.Now); l != nil {
+		t.Error("rate limiter without any limit should be nil")
+	}
+
+	var l *rateLimiter
+	if _, d, ok := l.reserve(&PublishPacket{}, 1); !ok || d != 0 {
+		t.Error("nil rate limiter should not throttle")
+	}
+}
+
+func TestRateLimiter_Pacer(t *testing.T) {
+	l := newRateLimiter([]*RateLimit{
+		{TopicPrefix: "telemetry/", MsgRate: 1},
+		{TopicPrefix: "telemetry/slow/", MsgRate: 1},
+	}, time.Now)
+
+	if r, _, _ := l.reserve(&PublishPacket{TopicName: "command/a"}, 1); r != nil {
+		t.Error("packet not matching any rule should not be paced")
+	}
+
+	if r, _, _ := l.reserve(&PublishPacket{TopicName: "telemetry/a"}, 1); r != l.rules[0] {
+		t.Error("packet should be paced by the only rule matched")
+	}
+
+	if r, d, _ := l.reserve(&PublishPacket{TopicName: "telemetry/slow/a", Qos: Qos1}, 1); r != l.rules[0] || d == 0 {
+		t.Errorf("packet should be paced by the rule with longest delay, delay = %v", d)
+	}
+}
+
+func TestAsyncClient_RateLimitPerRule(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	c, err := NewClient(
+		WithServer(b.addr()),
+		WithVersion(V311, false),
+		WithRateLimit(&RateLimit{TopicPrefix: "slow/", MsgRate: 1, MsgBurst: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy(true)
+	connectTestClient(t, c)
+
+	// slow/2 delayed for about one second
+	c.Publish(
+		&PublishPacket{TopicName: "slow/1", Qos: Qos1},
+		&PublishPacket{TopicName: "slow/2", Qos: Qos1},
+		&PublishPacket{TopicName: "fast/1", Qos: Qos1},
+	)
+
+	for i := 0; i < 2; i++ {
+		if p := b.waitPacket(t, CtrlPublish).(*PublishPacket); p.TopicName == "slow/2" {
+			t.Fatal("publish packet not matching rule sent after delayed one")
+		}
+	}
+	b.waitPacket(t, CtrlPublish)
+}
+
+func TestAsyncClient_RateLimitNotBlockingControlPackets(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	c, err := NewClient(
+		WithServer(b.addr()),
+		WithVersion(V311, false),
+		WithRateLimit(&RateLimit{MsgRate: 1, MsgBurst: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy(true)
+	connectTestClient(t, c)
+
+	// second packet delayed for about one second
+	c.Publish(
+		&PublishPacket{TopicName: "foo", Qos: Qos1, Payload: []byte("1")},
+		&PublishPacket{TopicName: "foo", Qos: Qos1, Payload: []byte("2")},
+	)
+	b.waitPacket(t, CtrlPublish)
+	c.Subscribe(&Topic{Name: "bar"})
+
+	start := time.Now()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case pkt := <-b.recvC:
+			switch pkt.Type() {
+			case CtrlSubscribe:
+				if d := time.Since(start); d > 500*time.Millisecond {
+					t.Errorf("subscribe packet blocked by rate limit for %v", d)
+				}
+				return
+			case CtrlPublish:
+				t.Fatal("subscribe packet sent after delayed publish packet")
+			}
+		case <-timeout:
+			t.Fatal("wait for subscribe packet timeout")
+		}
+	}
+}
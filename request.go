@@ -0,0 +1,198 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultRespTopicPrefix is the prefix of response topic if server
+// provided no response information
+const defaultRespTopicPrefix = "libmqtt/resp/"
+
+// RequestHandler handles request message (MQTT 5) with the context
+// extracted from the request, the returned payload is published to
+// the response topic of the request, no response is sent on error
+type RequestHandler func(ctx context.Context, req *PublishPacket) ([]byte, error)
+
+// requester tends to request/response correlation
+type requester struct {
+	once      *sync.Once
+	respTopic atomic.Value // string, response topic of the client
+	nextID    uint64
+	pending   *sync.Map // correlation id -> chan *PublishPacket
+
+	mu         *sync.Mutex
+	subscribed <-chan struct{} // closed when response topic subscribed, nil if never subscribed
+}
+
+func newRequester() *requester {
+	return &requester{once: &sync.Once{}, pending: &sync.Map{}, mu: &sync.Mutex{}}
+}
+
+// deliver the response message to the pending request
+func (r *requester) deliver(p *PublishPacket) {
+	if topic, _ := r.respTopic.Load().(string); topic == "" || p.TopicName != topic || p.Props == nil {
+		return
+	}
+
+	if ch, ok := r.pending.Load(string(p.Props.CorrelationData)); ok {
+		select {
+		case ch.(chan *PublishPacket) <- p:
+		default:
+		}
+	}
+}
+
+// subscribeResp subscribes the response topic unless it's subscribed or
+// being subscribed, returns the channel closed when subscribed
+func (c *AsyncClient) subscribeResp(respTopic string) <-chan struct{} {
+	r := c.requests
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.subscribed == nil {
+		// responses are dispatched by router, so they are verified
+		// as other messages (e.g. with VerifyingRouter)
+		c.HandlePacket(respTopic, r.deliver)
+	} else {
+		select {
+		case <-r.subscribed:
+			if _, ok := c.subs.get(respTopic); ok {
+				return r.subscribed
+			}
+		default:
+			return r.subscribed
+		}
+	}
+
+	r.subscribed = c.subs.wait(respTopic)
+	c.Subscribe(&Topic{Name: respTopic, Qos: Qos1, NoLocal: true})
+	return r.subscribed
+}
+
+// respTopic returns the response topic of this client, it's derived from
+// the response information provided by server in ConnAckProps if any
+func (c *AsyncClient) respTopic() string {
+	c.requests.once.Do(func() {
+		prefix := defaultRespTopicPrefix
+		if ack, ok := c.connAck.Load().(*ConnAckPacket); ok && ack.Props != nil && ack.Props.RespInfo != "" {
+			prefix = ack.Props.RespInfo
+			if !strings.HasSuffix(prefix, "/") {
+				prefix += "/"
+			}
+		}
+
+		id := make([]byte, 8)
+		rand.Read(id)
+		c.requests.respTopic.Store(prefix + hex.EncodeToString(id))
+	})
+
+	return c.requests.respTopic.Load().(string)
+}
+
+// Request publishes the request message (MQTT 5) to topic and waits for the
+// response, the response topic of this client is subscribed on first request
+// and responses are dispatched by the router, which MUST support packet
+// handlers (see `HandlePacket`)
+//
+// the request is canceled (no response expected anymore) when ctx is done
+//
+// responses are dispatched by the goroutine calling topic handlers, so it
+// MUST NOT be called in topic handlers (including RequestHandler),
+// ErrCalledInDispatch is returned in that case
+func (c *AsyncClient) Request(ctx context.Context, topic string, payload []byte) (*PublishPacket, error) {
+	if c.isClosing() {
+		return nil, ErrClientClosed
+	}
+
+	if !c.servers.useVersion(V5) {
+		return nil, ErrNotSupportedVersion
+	}
+
+	if c.inDispatch() {
+		return nil, ErrCalledInDispatch
+	}
+
+	respTopic := c.respTopic()
+	select {
+	case <-c.subscribeResp(respTopic):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.ctx.Done():
+		return nil, ErrClientClosed
+	}
+
+	id := strconv.FormatUint(atomic.AddUint64(&c.requests.nextID, 1), 36)
+	respCh := make(chan *PublishPacket, 1)
+	c.requests.pending.Store(id, respCh)
+	defer c.requests.pending.Delete(id)
+
+	c.PublishContext(ctx, &PublishPacket{
+		TopicName: topic,
+		Qos:       Qos1,
+		Payload:   payload,
+		Props: &PublishProps{
+			RespTopic:       respTopic,
+			CorrelationData: []byte(id),
+		},
+	})
+
+	select {
+	case resp := <-respCh:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.ctx.Done():
+		return nil, ErrClientClosed
+	}
+}
+
+// HandleRequest register request (MQTT 5) handler for topic, the payload
+// returned by the handler is published to the response topic of request
+// with the same correlation data
+//
+// messages without response topic are dispatched to h without response
+func (c *AsyncClient) HandleRequest(topic string, h RequestHandler) {
+	if h == nil {
+		return
+	}
+
+	c.HandleContext(topic, func(ctx context.Context, req *PublishPacket) {
+		payload, err := h(ctx, req)
+		if err != nil {
+			notifyDispatchMsg(c.msgCh, req.TopicName, err)
+			return
+		}
+
+		if req.Props == nil || req.Props.RespTopic == "" {
+			return
+		}
+
+		c.PublishContext(ctx, &PublishPacket{
+			TopicName: req.Props.RespTopic,
+			Qos:       req.Qos,
+			Payload:   payload,
+			Props:     &PublishProps{CorrelationData: req.Props.CorrelationData},
+		})
+	})
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsyncClient_Request(t *testing.T) {
+	b := newTestBroker(t, V5)
+	defer b.close()
+
+	b.connAck = func() *ConnAckPacket {
+		return &ConnAckPacket{Props: &ConnAckProps{
+			WildcardSubAvail: true,
+			SubIDAvail:       true,
+			SharedSubAvail:   true,
+			RespInfo:         "resp/test",
+		}}
+	}
+
+	c, err := NewClient(WithServer(b.addr()), WithVersion(V5, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Destroy(true)
+		c.Wait()
+	}()
+
+	c.HandleRequest("svc/echo", func(ctx context.Context, req *PublishPacket) ([]byte, error) {
+		return append([]byte("echo "), req.Payload...), nil
+	})
+
+	connectTestClient(t, c)
+	if conn := b.waitPacket(t, CtrlConn).(*ConnPacket); conn.Props == nil || !conn.Props.ReqRespInfo {
+		t.Error("response information not requested")
+	}
+
+	c.Subscribe(&Topic{Name: "svc/echo", Qos: Qos1})
+	b.waitPacket(t, CtrlSubscribe)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := c.Request(ctx, "svc/echo", []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(resp.Payload) != "echo ping" {
+		t.Errorf("response payload = %q", resp.Payload)
+	}
+
+	if !strings.HasPrefix(resp.TopicName, "resp/test/") {
+		t.Errorf("response topic = %q, not derived from response information", resp.TopicName)
+	}
+
+	// no responder
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.Request(ctx, "svc/none", nil); err != context.DeadlineExceeded {
+		t.Errorf("request without responder error = %v", err)
+	}
+}
+
+func TestAsyncClient_RequestV311(t *testing.T) {
+	c, err := NewClient(WithServer("localhost:1883"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Request(context.Background(), "foo", nil); err != ErrNotSupportedVersion {
+		t.Errorf("request with MQTT 3.1.1 error = %v", err)
+	}
+
+	// MQTT 5 server configured
+	c, err = NewClient(WithServer("localhost:1883"), WithServerConfig("localhost:1884", WithVersion(V5, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Request(ctx, "foo", nil); err != context.Canceled {
+		t.Errorf("request with MQTT 5 server error = %v", err)
+	}
+}
+
+func TestAsyncClient_RequestConcurrent(t *testing.T) {
+	b := newTestBroker(t, V5)
+	defer b.close()
+
+	c, err := NewClient(WithServer(b.addr()), WithVersion(V5, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Destroy(true)
+		c.Wait()
+	}()
+
+	errs := make(chan error, 2)
+	c.HandleRequest("svc/echo", func(ctx context.Context, req *PublishPacket) ([]byte, error) {
+		_, err := c.Request(ctx, "svc/other", nil)
+		errs <- err
+		return req.Payload, nil
+	})
+
+	connectTestClient(t, c)
+	c.Subscribe(&Topic{Name: "svc/echo", Qos: Qos1})
+	b.waitPacket(t, CtrlSubscribe)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := c.Request(ctx, "svc/echo", []byte("ping"))
+			results <- err
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Error(err)
+		}
+
+		if err := <-errs; err != ErrCalledInDispatch {
+			t.Errorf("request in handler error = %v, target = %v", err, ErrCalledInDispatch)
+		}
+	}
+
+	if n := len(c.subs.waiters); n != 0 {
+		t.Errorf("%d topics still waiting for subscription", n)
+	}
+
+	// response topic subscribed once
+	count := 0
+	for {
+		select {
+		case pkt := <-b.recvC:
+			if _, ok := pkt.(*SubscribePacket); ok {
+				count++
+			}
+		default:
+			if count != 1 {
+				t.Errorf("response topic subscribed %d times", count)
+			}
+			return
+		}
+	}
+}
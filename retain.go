@@ -0,0 +1,128 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrClientClosed is the error when client has been destroyed
+	ErrClientClosed = errors.New("client closed ")
+
+	// ErrCalledInDispatch is the error when a blocking call waiting for
+	// received messages is made by the goroutine dispatching them, e.g.
+	// in topic handlers
+	ErrCalledInDispatch = errors.New("blocking call in message dispatch ")
+)
+
+// retainCollector receives retained messages matching the topic filter
+type retainCollector struct {
+	filter string
+	ch     chan *PublishPacket
+	done   chan struct{}
+}
+
+// ClearRetained clears retained messages of topic(s) by publishing
+// zero length retained messages with the qos level
+func (c *AsyncClient) ClearRetained(qos QosLevel, topics ...string) {
+	msg := make([]*PublishPacket, len(topics))
+	for i, t := range topics {
+		msg[i] = &PublishPacket{TopicName: t, Qos: qos, IsRetain: true}
+	}
+
+	c.Publish(msg...)
+}
+
+// RetainedSnapshot subscribes the topic filter and collects retained messages
+// sent by server, until no more message arrived in the quiet period (counted
+// from the call, thus should be longer than the round trip time to server)
+//
+// the result is a map of topic name to the latest retained message, the
+// filter is unsubscribed afterwards unless it was already subscribed
+//
+// messages collected so far are returned with error if ctx is done
+//
+// retained messages are collected by the goroutine calling topic handlers,
+// so it MUST NOT be called in topic handlers, ErrCalledInDispatch is
+// returned in that case, call it in a new goroutine instead
+func (c *AsyncClient) RetainedSnapshot(ctx context.Context, filter string, quiet time.Duration) (map[string]*PublishPacket, error) {
+	if c.isClosing() {
+		return nil, ErrClientClosed
+	}
+
+	if c.inDispatch() {
+		return nil, ErrCalledInDispatch
+	}
+
+	rc := &retainCollector{filter: filter, ch: make(chan *PublishPacket), done: make(chan struct{})}
+	c.retainCollectors.Store(rc, struct{}{})
+	defer func() {
+		c.retainCollectors.Delete(rc)
+		close(rc.done)
+	}()
+
+	topic, subscribed := c.subs.get(filter)
+	if !subscribed {
+		topic = Topic{Name: filter, Qos: Qos1}
+	}
+	topic.RetainHandling = RetainSendOnSub
+	c.Subscribe(&topic)
+	if !subscribed {
+		defer c.UnSubscribe(filter)
+	}
+
+	result := make(map[string]*PublishPacket)
+	timer := time.NewTimer(quiet)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-c.ctx.Done():
+			return result, ErrClientClosed
+		case <-timer.C:
+			return result, nil
+		case p := <-rc.ch:
+			if len(p.Payload) == 0 {
+				delete(result, p.TopicName)
+			} else {
+				result[p.TopicName] = p
+			}
+
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(quiet)
+		}
+	}
+}
+
+// collectRetained sends the retained message to collectors
+func (c *AsyncClient) collectRetained(p *PublishPacket) {
+	c.retainCollectors.Range(func(k, _ interface{}) bool {
+		rc := k.(*retainCollector)
+		if matchTopic(rc.filter, p.TopicName) {
+			select {
+			case rc.ch <- p:
+			case <-rc.done:
+			}
+		}
+		return true
+	})
+}
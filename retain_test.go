@@ -0,0 +1,86 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAsyncClient_RetainedSnapshot(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	c, err := NewClient(WithServer(b.addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Destroy(true)
+		c.Wait()
+	}()
+
+	published := make(chan error, 4)
+	c.HandlePub(func(topic string, err error) {
+		published <- err
+	})
+
+	connectTestClient(t, c)
+	c.Publish(
+		&PublishPacket{TopicName: "foo/a", Qos: Qos1, IsRetain: true, Payload: []byte("a")},
+		&PublishPacket{TopicName: "foo/b", Qos: Qos1, IsRetain: true, Payload: []byte("b")},
+		&PublishPacket{TopicName: "bar/c", Qos: Qos1, IsRetain: true, Payload: []byte("c")},
+	)
+	c.ClearRetained(Qos1, "foo/b")
+	for i := 0; i < 4; i++ {
+		select {
+		case <-published:
+		case <-time.After(5 * time.Second):
+			t.Fatal("publish timeout")
+		}
+	}
+
+	retained, err := c.RetainedSnapshot(context.Background(), "foo/#", 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(retained) != 1 || retained["foo/a"] == nil || string(retained["foo/a"].Payload) != "a" {
+		t.Errorf("unexpected retained messages %v", retained)
+	}
+
+	if u := b.waitPacket(t, CtrlUnSub).(*UnSubPacket); u.TopicNames[0] != "foo/#" {
+		t.Errorf("unexpected unsubscribe topics %v", u.TopicNames)
+	}
+
+	// called in topic handler
+	errs := make(chan error, 1)
+	c.Handle("foo/a", func(topic string, qos QosLevel, msg []byte) {
+		_, err := c.RetainedSnapshot(context.Background(), "foo/#", 200*time.Millisecond)
+		errs <- err
+	})
+	c.Subscribe(&Topic{Name: "foo/a"})
+
+	select {
+	case err := <-errs:
+		if err != ErrCalledInDispatch {
+			t.Errorf("snapshot in handler err = %v, target = %v", err, ErrCalledInDispatch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("handler not called")
+	}
+}
@@ -18,6 +18,7 @@ package libmqtt
 
 import (
 	"regexp"
+	"strings"
 	"sync"
 )
 
@@ -36,7 +37,9 @@ func NewStandardRouter() *StandardRouter {
 	return &StandardRouter{m: &sync.Map{}}
 }
 
-// StandardRouter implements standard MQTT routing behaviour
+// StandardRouter implements standard MQTT routing behaviour,
+// topic filters with wildcards ('+' and '#') and shared subscriptions
+// ($share/<group>/<filter>) are supported
 type StandardRouter struct {
 	m *sync.Map
 }
@@ -51,12 +54,59 @@ func (s *StandardRouter) Name() string {
 
 // Handle defines how to register topic with handler
 func (s *StandardRouter) Handle(topic string, h TopicHandler) {
+	if s == nil || s.m == nil {
+		return
+	}
+
+	s.m.Store(topic, h)
+}
+
+// HandlePacket defines how to register topic with packet handler
+func (s *StandardRouter) HandlePacket(topic string, h PacketHandler) {
+	if s == nil || s.m == nil {
+		return
+	}
 
+	s.m.Store(topic, h)
 }
 
 // Dispatch defines the action to dispatch published packet
 func (s *StandardRouter) Dispatch(p *PublishPacket) {
+	if s == nil || s.m == nil {
+		return
+	}
 
+	s.m.Range(func(k, v interface{}) bool {
+		if matchTopic(sharedFilter(k.(string)), p.TopicName) {
+			dispatchTo(v, p)
+		}
+		return true
+	})
+}
+
+// matchTopic reports whether the topic name matches the topic filter
+func matchTopic(filter, topic string) bool {
+	// topics start with '$' are not matched by filters start with wildcard
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, f := range filterLevels {
+		switch {
+		case f == "#":
+			// matches the parent level and any number of child levels
+			return i == len(filterLevels)-1
+		case i >= len(topicLevels):
+			return false
+		case f == "+":
+		case f != topicLevels[i]:
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
 }
 
 // NewRegexRouter will create a regex router
@@ -78,12 +128,56 @@ func (r *RegexRouter) Name() string {
 	return "RegexRouter"
 }
 
-// Handle will register the topic with handler
+// Handle will register the topic with handler,
+// shared subscriptions ($share/<group>/<filter>) are registered with
+// the regex matching the topic filter
 func (r *RegexRouter) Handle(topicRegex string, h TopicHandler) {
 	if r == nil || r.m == nil {
 		return
 	}
-	r.m.Store(regexp.MustCompile(topicRegex), h)
+	r.m.Store(compileTopicRegex(topicRegex), h)
+}
+
+// HandlePacket will register the topic with packet handler
+func (r *RegexRouter) HandlePacket(topicRegex string, h PacketHandler) {
+	if r == nil || r.m == nil {
+		return
+	}
+	r.m.Store(compileTopicRegex(topicRegex), h)
+}
+
+func compileTopicRegex(topicRegex string) *regexp.Regexp {
+	if strings.HasPrefix(topicRegex, sharePrefix) {
+		return regexp.MustCompile(filterRegex(sharedFilter(topicRegex)))
+	}
+	return regexp.MustCompile(topicRegex)
+}
+
+// filterRegex converts the topic filter with wildcards to regex
+func filterRegex(filter string) string {
+	levels := strings.Split(filter, "/")
+	multi := levels[len(levels)-1] == "#"
+	if multi {
+		levels = levels[:len(levels)-1]
+	}
+
+	for i, l := range levels {
+		if l == "+" {
+			levels[i] = "[^/]*"
+		} else {
+			levels[i] = regexp.QuoteMeta(l)
+		}
+	}
+
+	switch {
+	case !multi:
+		return "^" + strings.Join(levels, "/") + "$"
+	case len(levels) == 0:
+		return "^.*$"
+	default:
+		// matches the parent level and any number of child levels
+		return "^" + strings.Join(levels, "/") + "(/.*)?$"
+	}
 }
 
 // Dispatch the received packet
@@ -94,8 +188,7 @@ func (r *RegexRouter) Dispatch(p *PublishPacket) {
 
 	r.m.Range(func(k, v interface{}) bool {
 		if reg := k.(*regexp.Regexp); reg.MatchString(p.TopicName) {
-			handler := v.(TopicHandler)
-			handler(p.TopicName, p.Qos, p.Payload)
+			dispatchTo(v, p)
 		}
 		return true
 	})
@@ -103,13 +196,15 @@ func (r *RegexRouter) Dispatch(p *PublishPacket) {
 
 // NewTextRouter will create a text based router
 func NewTextRouter() *TextRouter {
-	return &TextRouter{m: &sync.Map{}}
+	return &TextRouter{m: &sync.Map{}, filters: &sync.Map{}}
 }
 
-// TextRouter uses plain string comparison to dispatch topic message
+// TextRouter uses plain string comparison to dispatch topic message,
+// topic filters with wildcards ('+' and '#') are matched as StandardRouter
 // this is the default router in client
 type TextRouter struct {
-	m *sync.Map
+	m       *sync.Map
+	filters *sync.Map // handlers of topic filters with wildcards
 }
 
 // Name of TextRouter is "TextRouter"
@@ -121,13 +216,33 @@ func (r *TextRouter) Name() string {
 	return "TextRouter"
 }
 
-// Handle will register the topic with handler
+// Handle will register the topic with handler,
+// shared subscriptions are registered with the topic filter
 func (r *TextRouter) Handle(topic string, h TopicHandler) {
 	if r == nil || r.m == nil {
 		return
 	}
 
-	r.m.Store(topic, h)
+	r.store(topic, h)
+}
+
+// HandlePacket will register the topic with packet handler
+func (r *TextRouter) HandlePacket(topic string, h PacketHandler) {
+	if r == nil || r.m == nil {
+		return
+	}
+
+	r.store(topic, h)
+}
+
+func (r *TextRouter) store(topic string, h interface{}) {
+	filter := sharedFilter(topic)
+	if r.filters != nil && strings.ContainsAny(filter, "+#") {
+		r.filters.Store(filter, h)
+		return
+	}
+
+	r.m.Store(filter, h)
 }
 
 // Dispatch the received packet
@@ -137,7 +252,127 @@ func (r *TextRouter) Dispatch(p *PublishPacket) {
 	}
 
 	if h, ok := r.m.Load(p.TopicName); ok {
-		handler := h.(TopicHandler)
+		dispatchTo(h, p)
+	}
+
+	if r.filters != nil {
+		r.filters.Range(func(k, v interface{}) bool {
+			if matchTopic(k.(string), p.TopicName) {
+				dispatchTo(v, p)
+			}
+			return true
+		})
+	}
+}
+
+// packetRouter is the router able to dispatch publish packets to
+// packet handlers
+type packetRouter interface {
+	HandlePacket(topic string, h PacketHandler)
+}
+
+// topicHandler wraps the packet handler for routers without packet
+// handler support, the packet has topic name, qos and payload only
+func topicHandler(h PacketHandler) TopicHandler {
+	return func(topic string, qos QosLevel, msg []byte) {
+		h(&PublishPacket{TopicName: topic, Qos: qos, Payload: msg})
+	}
+}
+
+// dispatchTo calls the handler (TopicHandler or PacketHandler) with p
+func dispatchTo(h interface{}, p *PublishPacket) {
+	switch handler := h.(type) {
+	case TopicHandler:
 		handler(p.TopicName, p.Qos, p.Payload)
+	case PacketHandler:
+		handler(p)
+	}
+}
+
+// subIDRouter is the router able to dispatch by subscription identifier
+type subIDRouter interface {
+	HandleSubID(subID uint32, h TopicHandler)
+}
+
+// NewSubIDRouter will create a router dispatching by subscription identifier,
+// packets without known subscription identifier are dispatched by fallback
+// (TextRouter if nil)
+func NewSubIDRouter(fallback TopicRouter) *SubIDRouter {
+	if fallback == nil {
+		fallback = NewTextRouter()
+	}
+	return &SubIDRouter{m: &sync.Map{}, fallback: fallback}
+}
+
+// SubIDRouter uses subscription identifiers (since MQTT 5) reported by
+// server in PublishProps.SubIDs to dispatch topic message, servers without
+// subscription identifier support will not report them, thus the fallback
+// router is used
+type SubIDRouter struct {
+	m        *sync.Map
+	fallback TopicRouter
+}
+
+// Name of SubIDRouter is "SubIDRouter"
+func (r *SubIDRouter) Name() string {
+	if r == nil {
+		return "<nil>"
+	}
+
+	return "SubIDRouter"
+}
+
+// Handle will register the topic with handler in fallback router
+func (r *SubIDRouter) Handle(topic string, h TopicHandler) {
+	if r == nil || r.fallback == nil {
+		return
+	}
+
+	r.fallback.Handle(topic, h)
+}
+
+// HandlePacket will register the topic with packet handler in fallback
+// router, if the fallback router does not support packet handlers, the
+// packet passed to h has topic name, qos and payload only
+func (r *SubIDRouter) HandlePacket(topic string, h PacketHandler) {
+	if r == nil || r.fallback == nil {
+		return
+	}
+
+	if pr, ok := r.fallback.(packetRouter); ok {
+		pr.HandlePacket(topic, h)
+		return
+	}
+
+	r.fallback.Handle(topic, topicHandler(h))
+}
+
+// HandleSubID will register the subscription identifier with handler
+func (r *SubIDRouter) HandleSubID(subID uint32, h TopicHandler) {
+	if r == nil || r.m == nil {
+		return
+	}
+
+	r.m.Store(subID, h)
+}
+
+// Dispatch the received packet
+func (r *SubIDRouter) Dispatch(p *PublishPacket) {
+	if r == nil || r.m == nil {
+		return
+	}
+
+	dispatched := false
+	if p.Props != nil {
+		for _, id := range p.Props.SubIDs {
+			if h, ok := r.m.Load(uint32(id)); ok {
+				dispatchTo(h, p)
+				dispatched = true
+			}
+		}
+	}
+
+	if !dispatched && r.fallback != nil {
+		r.fallback.Dispatch(p)
 	}
 }
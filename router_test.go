@@ -104,3 +104,154 @@ func TestRegexRouter_Dispatch(t *testing.T) {
 func TestRestRouter_Dispatch(t *testing.T) {
 
 }
+
+func TestSubIDRouter_Dispatch(t *testing.T) {
+	r := NewSubIDRouter(nil)
+	idCount, textCount := 0, 0
+
+	r.HandleSubID(1, func(topic string, code byte, msg []byte) {
+		idCount++
+	})
+
+	r.Handle("foo", func(topic string, code byte, msg []byte) {
+		textCount++
+	})
+
+	pkts := []*PublishPacket{
+		// dispatched by subscription identifier
+		{TopicName: "foo", Props: &PublishProps{SubIDs: []int{1}}},
+		{TopicName: "bar", Props: &PublishProps{SubIDs: []int{2, 1}}},
+		// unknown subscription identifier, dispatched by topic
+		{TopicName: "foo", Props: &PublishProps{SubIDs: []int{2}}},
+		// no subscription identifier, dispatched by topic
+		{TopicName: "foo"},
+	}
+
+	for _, v := range pkts {
+		r.Dispatch(v)
+	}
+
+	if idCount != 2 {
+		t.Error("fail at subscription identifier pkt count =", idCount)
+	}
+
+	if textCount != 2 {
+		t.Error("fail at fallback pkt count =", textCount)
+	}
+}
+
+func TestStandardRouter_Dispatch(t *testing.T) {
+	r := NewStandardRouter()
+	counts := make(map[string]int)
+	for _, f := range []string{"a/b", "a/+", "a/#", "+/b", "#", "$share/g/a/+", "$SYS/#"} {
+		filter := f
+		r.Handle(filter, func(topic string, code byte, msg []byte) {
+			counts[filter]++
+		})
+	}
+
+	for _, topic := range []string{"a/b", "a", "a/c", "a/b/c", "$SYS/uptime"} {
+		r.Dispatch(&PublishPacket{TopicName: topic})
+	}
+
+	target := map[string]int{
+		"a/b":          1,
+		"a/+":          2,
+		"a/#":          4,
+		"+/b":          1,
+		"#":            4,
+		"$share/g/a/+": 2,
+		"$SYS/#":       1,
+	}
+	for filter, n := range target {
+		if counts[filter] != n {
+			t.Errorf("filter %q matched %d times, target = %d", filter, counts[filter], n)
+		}
+	}
+}
+
+func TestTextRouter_DispatchShared(t *testing.T) {
+	r := NewTextRouter()
+	count := 0
+	r.Handle("$share/g/foo", func(topic string, code byte, msg []byte) {
+		count++
+	})
+
+	r.Dispatch(&PublishPacket{TopicName: "foo"})
+	if count != 1 {
+		t.Error("shared subscription not dispatched")
+	}
+
+	r.Handle("$share/g/sensors/+", func(topic string, code byte, msg []byte) {
+		count++
+	})
+	r.Dispatch(&PublishPacket{TopicName: "sensors/1"})
+	r.Dispatch(&PublishPacket{TopicName: "sensors/1/temperature"})
+	if count != 2 {
+		t.Errorf("shared subscription with wildcard dispatched %d times, target = 1", count-1)
+	}
+}
+
+func TestRegexRouter_DispatchShared(t *testing.T) {
+	r := NewRegexRouter()
+	counts := make(map[string]int)
+	for _, f := range []string{"$share/g/a/+", "$share/g/a/#", "$share/g/#", "$share/g/a.b"} {
+		filter := f
+		r.Handle(filter, func(topic string, code byte, msg []byte) {
+			counts[filter]++
+		})
+	}
+
+	for _, topic := range []string{"a", "a/b", "a/b/c", "axb"} {
+		r.Dispatch(&PublishPacket{TopicName: topic})
+	}
+
+	target := map[string]int{
+		"$share/g/a/+": 1,
+		"$share/g/a/#": 3,
+		"$share/g/#":   4,
+		"$share/g/a.b": 0,
+	}
+	for filter, n := range target {
+		if counts[filter] != n {
+			t.Errorf("filter %q matched %d times, target = %d", filter, counts[filter], n)
+		}
+	}
+}
+
+func TestRouters_HandlePacket(t *testing.T) {
+	routers := map[string]interface {
+		TopicRouter
+		packetRouter
+	}{
+		"text":     NewTextRouter(),
+		"regex":    NewRegexRouter(),
+		"standard": NewStandardRouter(),
+		"subID":    NewSubIDRouter(nil),
+	}
+
+	pkt := &PublishPacket{TopicName: "foo", Props: &PublishProps{ContentType: "text/plain"}}
+	for name, r := range routers {
+		var received *PublishPacket
+		r.HandlePacket("foo", func(p *PublishPacket) {
+			received = p
+		})
+		r.Dispatch(pkt)
+
+		if received != pkt {
+			t.Errorf("%s router dispatched packet %v, target = %v", name, received, pkt)
+		}
+	}
+
+	// fallback router without packet handler support
+	r := NewSubIDRouter(struct{ TopicRouter }{NewTextRouter()})
+	var received *PublishPacket
+	r.HandlePacket("foo", func(p *PublishPacket) {
+		received = p
+	})
+	r.Dispatch(pkt)
+
+	if received == nil || received.TopicName != "foo" {
+		t.Errorf("subID router with topic router dispatched packet %v", received)
+	}
+}
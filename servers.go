@@ -0,0 +1,196 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrServerExists is the error when adding a server already added
+	ErrServerExists = errors.New("server already exists ")
+)
+
+// serverConn is a server the client connects to
+type serverConn struct {
+	name    string
+	secure  bool           // use default tls config (WithSecureServer)
+	options *clientOptions // connection options of the server
+
+	ctx    context.Context    // canceled when server removed
+	cancel context.CancelFunc // stop connecting to server
+
+	mu      *sync.Mutex
+	conn    *clientConn // current connection, nil if not connected
+	removed bool        // server removed, stop reconnecting
+}
+
+// remove marks server removed and returns the current connection
+func (s *serverConn) remove() *clientConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed = true
+	return s.conn
+}
+
+func (s *serverConn) isRemoved() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removed
+}
+
+// setConnection records the current connection,
+// returns false if server removed
+func (s *serverConn) setConnection(conn *clientConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removed && conn != nil {
+		return false
+	}
+	s.conn = conn
+	return true
+}
+
+// serverRegistry records servers of client
+type serverRegistry struct {
+	mu      *sync.Mutex
+	servers []*serverConn
+	started bool        // Connect called
+	handler ConnHandler // handler passed to Connect
+}
+
+func newServerRegistry() *serverRegistry {
+	return &serverRegistry{mu: &sync.Mutex{}}
+}
+
+// useVersion reports whether the protocol version is used by connected
+// servers, or by any server if none connected
+func (r *serverRegistry) useVersion(v ProtoVersion) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	connected, used := false, false
+	for _, s := range r.servers {
+		s.mu.Lock()
+		conn := s.conn
+		s.mu.Unlock()
+
+		if conn != nil {
+			if !connected {
+				connected, used = true, false
+			}
+			used = used || conn.protoVersion == v
+		} else if !connected {
+			used = used || s.options.protoVersion == v
+		}
+	}
+	return used
+}
+
+// addServer registers server, starts connecting if client connected
+func (c *AsyncClient) addServer(server string, secure bool, options *clientOptions) error {
+	c.servers.mu.Lock()
+	defer c.servers.mu.Unlock()
+
+	for _, s := range c.servers.servers {
+		if s.name == server {
+			return ErrServerExists
+		}
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	s := &serverConn{
+		name:    server,
+		secure:  secure,
+		options: options,
+		ctx:     ctx,
+		cancel:  cancel,
+		mu:      &sync.Mutex{},
+	}
+	c.servers.servers = append(c.servers.servers, s)
+
+	if c.servers.started {
+		c.workers.Add(1)
+		go c.connect(s, c.servers.handler)
+	}
+	return nil
+}
+
+// AddServer adds the server with its own connection options (see
+// WithServerConfig) at runtime, the client starts connecting to it
+// if Connect has been called
+func (c *AsyncClient) AddServer(server string, opts ...Option) error {
+	if c.isClosing() {
+		return ErrClientClosed
+	}
+
+	options, err := c.options.override(opts)
+	if err != nil {
+		return err
+	}
+
+	c.log.i("CLI add server", logServer(server))
+	return c.addServer(server, false, options)
+}
+
+// RemoveServer stops connecting to the server at runtime, the connection
+// to server (if any) is disconnected gracefully with DisConnPacket,
+// returns false if no such server
+func (c *AsyncClient) RemoveServer(server string) bool {
+	c.servers.mu.Lock()
+	var s *serverConn
+	for i, v := range c.servers.servers {
+		if v.name == server {
+			s = v
+			c.servers.servers = append(c.servers.servers[:i], c.servers.servers[i+1:]...)
+			break
+		}
+	}
+	c.servers.mu.Unlock()
+
+	if s == nil {
+		return false
+	}
+
+	c.log.i("CLI remove server", logServer(server))
+	if conn := s.remove(); conn != nil {
+		conn.send(&DisConnPacket{})
+
+		// wait for the connection closed
+		select {
+		case <-conn.ctx.Done():
+		case <-time.After(s.options.dialTimeout):
+		}
+	}
+
+	s.cancel()
+	return true
+}
+
+// Servers returns addresses of all servers of the client
+func (c *AsyncClient) Servers() []string {
+	c.servers.mu.Lock()
+	defer c.servers.mu.Unlock()
+
+	servers := make([]string, len(c.servers.servers))
+	for i, s := range c.servers.servers {
+		servers[i] = s.name
+	}
+	return servers
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsyncClient_Servers(t *testing.T) {
+	c, err := NewClient(
+		WithServer("localhost:1883"),
+		WithSecureServer("localhost:8883"),
+		WithServerConfig("localhost:1884", WithClientID("other")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy(true)
+
+	servers := c.Servers()
+	expected := []string{"localhost:1883", "localhost:1884", "localhost:8883"}
+	if len(servers) != len(expected) {
+		t.Fatalf("servers = %v, want %v", servers, expected)
+	}
+	for i := range expected {
+		if servers[i] != expected[i] {
+			t.Errorf("servers[%d] = %q, want %q", i, servers[i], expected[i])
+		}
+	}
+
+	if err := c.AddServer("localhost:1883"); err != ErrServerExists {
+		t.Errorf("add existing server error = %v, want %v", err, ErrServerExists)
+	}
+
+	if c.RemoveServer("localhost:1885") {
+		t.Error("remove unknown server returned true")
+	}
+	if !c.RemoveServer("localhost:1884") {
+		t.Error("remove server returned false")
+	}
+	if len(c.Servers()) != 2 {
+		t.Errorf("servers = %v after remove", c.Servers())
+	}
+}
+
+func TestAsyncClient_AddRemoveServer(t *testing.T) {
+	b1 := newTestBroker(t, V311)
+	defer b1.close()
+	b2 := newTestBroker(t, V311)
+	defer b2.close()
+
+	c, err := NewClient(
+		WithServer(b1.addr()),
+		WithVersion(V311, false),
+		WithAutoReconnect(true),
+		WithBackoffStrategy(10*time.Millisecond, 10*time.Millisecond, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy(true)
+
+	connected := make(chan string, 2)
+	c.Connect(func(server string, code byte, err error) {
+		if err != nil {
+			t.Error("connect failed:", server, err)
+			return
+		}
+		connected <- server
+	})
+
+	waitServer := func(server string) {
+		select {
+		case s := <-connected:
+			if s != server {
+				t.Fatalf("connected to %q, want %q", s, server)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("connect timeout:", server)
+		}
+	}
+	waitServer(b1.addr())
+
+	if err := c.AddServer(b2.addr(), WithClientID("second")); err != nil {
+		t.Fatal(err)
+	}
+	waitServer(b2.addr())
+
+	if conn := b2.waitPacket(t, CtrlConn).(*ConnPacket); conn.ClientID != "second" {
+		t.Errorf("client id = %q, want %q", conn.ClientID, "second")
+	}
+
+	if !c.RemoveServer(b2.addr()) {
+		t.Fatal("remove server returned false")
+	}
+	b2.waitPacket(t, CtrlDisConn)
+
+	// removed server must not be reconnected
+	select {
+	case s := <-connected:
+		t.Fatal("reconnected to removed server:", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// client still works with other servers
+	if servers := c.Servers(); len(servers) != 1 || servers[0] != b1.addr() {
+		t.Errorf("servers = %v, want [%s]", servers, b1.addr())
+	}
+}
+
+func TestAsyncClient_AddServerWithoutServers(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	c, err := NewClient(WithVersion(V311, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy(true)
+
+	connected := make(chan error, 1)
+	c.Connect(func(server string, code byte, err error) {
+		connected <- err
+	})
+
+	if err := c.AddServer(b.addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-connected:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connect timeout")
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoSRVRecord is the error when no broker found in SRV records
+	ErrNoSRVRecord = errors.New("no broker found in SRV records ")
+)
+
+const (
+	srvService       = "mqtt"
+	srvSecureService = "secure-mqtt"
+)
+
+// Resolver looks up DNS SRV records, *net.Resolver is a Resolver
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// WithSRV set domains to discover brokers with SRV records
+// `_secure-mqtt._tcp.<domain>` and `_mqtt._tcp.<domain>`,
+// same as WithServer("srv://<domain>")
+//
+// brokers are ordered by priority and weight (RFC 2782), secure brokers
+// first, and resolved again on every reconnect
+func WithSRV(domains ...string) Option {
+	return func(c *AsyncClient) error {
+		for _, domain := range domains {
+			c.options.servers = append(c.options.servers, "srv://"+domain)
+		}
+		return nil
+	}
+}
+
+// WithResolver set the resolver to look up SRV records,
+// default is net.DefaultResolver
+func WithResolver(r Resolver) Option {
+	return connOption(func(c *AsyncClient) error {
+		if r == nil {
+			return errors.New("nil resolver ")
+		}
+
+		c.options.resolver = r
+		return nil
+	})
+}
+
+// lookupSRV returns broker addresses of domain, secure brokers are
+// returned with `tls://` scheme
+func lookupSRV(ctx context.Context, r Resolver, domain string) ([]string, error) {
+	var servers []string
+	var lastErr error
+	resolved := false
+	for _, service := range []string{srvSecureService, srvService} {
+		_, records, err := r.LookupSRV(ctx, service, "tcp", domain)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resolved = true
+
+		for _, rec := range orderSRV(records) {
+			target := strings.TrimSuffix(rec.Target, ".")
+			if target == "" {
+				// service decidedly not available
+				continue
+			}
+
+			server := net.JoinHostPort(target, strconv.Itoa(int(rec.Port)))
+			if service == srvSecureService {
+				server = "tls://" + server
+			}
+			servers = append(servers, server)
+		}
+	}
+
+	if len(servers) == 0 {
+		if !resolved {
+			return nil, lastErr
+		}
+		return nil, ErrNoSRVRecord
+	}
+	return servers, nil
+}
+
+// orderSRV orders records by priority, records with same priority are
+// ordered by weighted random selection
+func orderSRV(records []*net.SRV) []*net.SRV {
+	sorted := make([]*net.SRV, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].Priority == sorted[i].Priority {
+			j++
+		}
+		shuffleByWeight(sorted[i:j])
+		i = j
+	}
+	return sorted
+}
+
+// shuffleByWeight orders records with the selection algorithm in RFC 2782,
+// records with zero weight have a small chance to be selected
+func shuffleByWeight(records []*net.SRV) {
+	// zero weight records are placed at the beginning
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Weight == 0 && records[j].Weight != 0
+	})
+
+	sum := 0
+	for _, r := range records {
+		sum += int(r.Weight)
+	}
+
+	for i := range records {
+		// select the first record whose running sum is not less
+		// than a random number in [0, sum]
+		n, running := rand.Intn(sum+1), 0
+		for j := i; j < len(records); j++ {
+			running += int(records[j].Weight)
+			if running >= n {
+				r := records[j]
+				copy(records[i+1:j+1], records[i:j])
+				records[i] = r
+				break
+			}
+		}
+		sum -= int(records[i].Weight)
+	}
+}
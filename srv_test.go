@@ -0,0 +1,216 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testResolver resolves SRV records from memory
+type testResolver struct {
+	mu      *sync.Mutex
+	records map[string][]*net.SRV
+	lookups int
+}
+
+func newTestResolver() *testResolver {
+	return &testResolver{mu: &sync.Mutex{}, records: make(map[string][]*net.SRV)}
+}
+
+func (r *testResolver) set(service string, records ...*net.SRV) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[service] = records
+}
+
+func (r *testResolver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+func (r *testResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if service == srvService {
+		r.lookups++
+	}
+
+	records, ok := r.records[service]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return "_" + service + "._" + proto + "." + name + ".", records, nil
+}
+
+// srvRecord creates SRV record for test broker
+func srvRecord(t *testing.T, b *testBroker, priority, weight uint16) *net.SRV {
+	host, port, err := net.SplitHostPort(b.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := strconv.Atoi(port)
+	return &net.SRV{Target: host + ".", Port: uint16(p), Priority: priority, Weight: weight}
+}
+
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "c", Priority: 20, Weight: 0},
+		{Target: "a1", Priority: 10, Weight: 0},
+		{Target: "b", Priority: 15, Weight: 5},
+		{Target: "a2", Priority: 10, Weight: 0},
+	}
+
+	ordered := orderSRV(records)
+	if len(ordered) != len(records) {
+		t.Fatalf("ordered %d records, want %d", len(ordered), len(records))
+	}
+	for i, p := range []uint16{10, 10, 15, 20} {
+		if ordered[i].Priority != p {
+			t.Errorf("ordered[%d].Priority = %d, want %d", i, ordered[i].Priority, p)
+		}
+	}
+
+	// heavier record selected first more often
+	first := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		ordered := orderSRV([]*net.SRV{
+			{Target: "light", Weight: 10},
+			{Target: "heavy", Weight: 90},
+			{Target: "zero", Weight: 0},
+		})
+		first[ordered[0].Target]++
+	}
+	if first["heavy"] < 800 || first["light"] < 50 || first["zero"] > 50 {
+		t.Errorf("unexpected weighted selection %v", first)
+	}
+
+	// zero weight records have a small chance to be selected first
+	first = make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		ordered := orderSRV([]*net.SRV{
+			{Target: "weighted", Weight: 1},
+			{Target: "zero", Weight: 0},
+		})
+		first[ordered[0].Target]++
+	}
+	if first["zero"] < 350 || first["weighted"] < 350 {
+		t.Errorf("unexpected zero weight selection %v", first)
+	}
+}
+
+func TestLookupSRV(t *testing.T) {
+	r := newTestResolver()
+	if _, err := lookupSRV(context.Background(), r, "example.com"); err == nil {
+		t.Error("lookup without records succeeded")
+	}
+
+	r.set(srvService, &net.SRV{Target: ".", Port: 0})
+	if _, err := lookupSRV(context.Background(), r, "example.com"); err != ErrNoSRVRecord {
+		t.Errorf("lookup error = %v, want %v", err, ErrNoSRVRecord)
+	}
+
+	r.set(srvService,
+		&net.SRV{Target: "b.example.com.", Port: 1884, Priority: 2},
+		&net.SRV{Target: "a.example.com.", Port: 1883, Priority: 1},
+	)
+	r.set(srvSecureService, &net.SRV{Target: "s.example.com.", Port: 8883})
+	servers, err := lookupSRV(context.Background(), r, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"tls://s.example.com:8883", "a.example.com:1883", "b.example.com:1884"}
+	if len(servers) != len(expected) {
+		t.Fatalf("servers = %v, want %v", servers, expected)
+	}
+	for i := range expected {
+		if servers[i] != expected[i] {
+			t.Errorf("servers[%d] = %q, want %q", i, servers[i], expected[i])
+		}
+	}
+}
+
+func TestAsyncClient_SRV(t *testing.T) {
+	b1 := newTestBroker(t, V311)
+	defer b1.close()
+	b2 := newTestBroker(t, V311)
+	defer b2.close()
+
+	// unreachable broker with higher priority
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+	p, _ := strconv.Atoi(port)
+
+	r := newTestResolver()
+	r.set(srvService, &net.SRV{Target: "127.0.0.1.", Port: uint16(p)}, srvRecord(t, b1, 1, 0))
+
+	c, err := NewClient(
+		WithSRV("example.com"),
+		WithResolver(r),
+		WithVersion(V311, false),
+		WithAutoReconnect(true),
+		WithBackoffStrategy(10*time.Millisecond, 10*time.Millisecond, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy(true)
+
+	if servers := c.Servers(); len(servers) != 1 || servers[0] != "srv://example.com" {
+		t.Errorf("servers = %v, want [srv://example.com]", servers)
+	}
+
+	connected := make(chan string, 2)
+	c.Connect(func(server string, code byte, err error) {
+		if err == nil {
+			connected <- server
+		}
+	})
+
+	waitServer := func(b *testBroker) {
+		select {
+		case s := <-connected:
+			if s != "srv://example.com" {
+				t.Fatalf("connected to %q, want %q", s, "srv://example.com")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("connect timeout:", b.addr())
+		}
+		b.waitPacket(t, CtrlConn)
+	}
+	waitServer(b1)
+
+	// records resolved again on reconnect
+	r.set(srvService, srvRecord(t, b2, 0, 0))
+	b1.disconnect()
+	waitServer(b2)
+
+	if n := r.count(); n < 2 {
+		t.Errorf("SRV records resolved %d times, want at least 2", n)
+	}
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// maxSubID is the max value of subscription identifier
+	maxSubID = 268435455
+
+	// sharePrefix is the prefix of shared subscription topic filter
+	sharePrefix = "$share/"
+)
+
+var (
+	// ErrInvalidShareGroup is the error when share name of shared
+	// subscription is empty or contains '/', '+' or '#'
+	ErrInvalidShareGroup = errors.New("invalid share group name ")
+
+	// ErrSharedSubNotAvail is the error when server does not support
+	// shared subscription
+	ErrSharedSubNotAvail = errors.New("shared subscription not supported by server ")
+)
+
+// sharedTopic returns the shared subscription topic filter
+// $share/<group>/<filter>
+func sharedTopic(group, filter string) (string, error) {
+	if group == "" || strings.ContainsAny(group, "/+#") {
+		return "", ErrInvalidShareGroup
+	}
+
+	return sharePrefix + group + "/" + filter, nil
+}
+
+// sharedFilter strips the $share/<group>/ prefix of shared subscription,
+// returns the topic filter as is if not shared
+func sharedFilter(topic string) string {
+	if !strings.HasPrefix(topic, sharePrefix) {
+		return topic
+	}
+
+	rest := topic[len(sharePrefix):]
+	if i := strings.IndexByte(rest, '/'); i > 0 {
+		return rest[i+1:]
+	}
+	return topic
+}
+
+// subscription is an active subscription acknowledged by server
+type subscription struct {
+	topic Topic
+	subID uint32 // subscription identifier, 0 if not set
+}
+
+// subRegistry records active subscriptions acknowledged by server
+type subRegistry struct {
+	mu     *sync.Mutex
+	subs   map[string]*subscription
+	order  []string // topic names in subscription order
+	lastID uint32   // last allocated subscription identifier
+
+	waiters map[string][]chan struct{} // closed when topic subscribed
+}
+
+func newSubRegistry() *subRegistry {
+	return &subRegistry{
+		mu:      &sync.Mutex{},
+		subs:    make(map[string]*subscription),
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+// nextSubID allocates a subscription identifier
+func (r *subRegistry) nextSubID() uint32 {
+	for {
+		id := atomic.AddUint32(&r.lastID, 1)
+		if id <= maxSubID {
+			return id
+		}
+		atomic.CompareAndSwapUint32(&r.lastID, id, 0)
+	}
+}
+
+// subscribed records topics with their granted subscribe codes
+func (r *subRegistry) subscribed(s *SubscribePacket, codes []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var subID uint32
+	if s.Props != nil {
+		subID = s.Props.SubID
+	}
+
+	for i, t := range s.Topics {
+		if i >= len(codes) || codes[i] >= SubFail {
+			continue
+		}
+
+		if _, ok := r.subs[t.Name]; !ok {
+			r.order = append(r.order, t.Name)
+		}
+		r.subs[t.Name] = &subscription{topic: *t, subID: subID}
+
+		for _, ch := range r.waiters[t.Name] {
+			close(ch)
+		}
+		delete(r.waiters, t.Name)
+	}
+}
+
+// wait returns a channel closed when the topic is subscribed
+func (r *subRegistry) wait(name string) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan struct{})
+	if _, ok := r.subs[name]; ok {
+		close(ch)
+	} else {
+		r.waiters[name] = append(r.waiters[name], ch)
+	}
+	return ch
+}
+
+// get returns the active subscription of the topic
+func (r *subRegistry) get(name string) (Topic, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sub, ok := r.subs[name]; ok {
+		return sub.topic, true
+	}
+	return Topic{}, false
+}
+
+// unSubscribed removes topics
+func (r *subRegistry) unSubscribed(names []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range names {
+		if _, ok := r.subs[name]; !ok {
+			continue
+		}
+
+		delete(r.subs, name)
+		for i, n := range r.order {
+			if n == name {
+				r.order = append(r.order[:i], r.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// active returns subscribe packets of all active subscriptions in
+// subscription order, grouped by subscription identifier
+func (r *subRegistry) active() []*SubscribePacket {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		result []*SubscribePacket
+		groups = make(map[uint32]*SubscribePacket)
+	)
+	for _, name := range r.order {
+		sub := r.subs[name]
+		s, ok := groups[sub.subID]
+		if !ok {
+			s = &SubscribePacket{}
+			if sub.subID != 0 {
+				s.Props = &SubscribeProps{SubID: sub.subID}
+			}
+			groups[sub.subID] = s
+			result = append(result, s)
+		}
+
+		topic := sub.topic
+		s.Topics = append(s.Topics, &topic)
+	}
+	return result
+}
+
+// resubscribe the active subscriptions with a new session
+func (c *clientConn) resubscribe() {
+	for _, s := range c.parent.subs.active() {
+		c.parent.log.i("NET resubscribe for new session", logServer(c.name), logField("topics", s.Topics))
+		s.PacketID = c.parent.idGen.next(s)
+		if pkt := c.prepareSubscribe(s); pkt != nil {
+			c.send(pkt)
+		}
+	}
+}
+
+// subIDAvail reports whether server supports subscription identifier
+func (c *clientConn) subIDAvail() bool {
+	return c.protoVersion == V5 && c.connAck != nil &&
+		c.connAck.Props != nil && c.connAck.Props.SubIDAvail
+}
+
+// sharedSubAvail reports whether server supports shared subscription,
+// always true for MQTT 3.1.1 since the server can not report it
+func (c *clientConn) sharedSubAvail() bool {
+	return c.protoVersion != V5 || c.connAck == nil ||
+		c.connAck.Props == nil || c.connAck.Props.SharedSubAvail
+}
+
+// prepareSubscribe checks the subscribe packet against server capabilities,
+// returns nil if the packet can not be sent
+func (c *clientConn) prepareSubscribe(s *SubscribePacket) *SubscribePacket {
+	if !c.sharedSubAvail() {
+		for _, t := range s.Topics {
+			if strings.HasPrefix(t.Name, sharePrefix) {
+				c.parent.log.w("NET shared subscription not supported by server", logServer(c.name), logTopic(t.Name))
+				c.parent.idGen.free(s.PacketID)
+				notifySubMsg(c.parent.msgCh, s.Topics, ErrSharedSubNotAvail)
+				return nil
+			}
+		}
+	}
+
+	return c.stripSubID(s)
+}
+
+// stripSubID returns a copy of s without subscription identifier if server
+// does not support it, the original packet is kept for ack handling
+func (c *clientConn) stripSubID(s *SubscribePacket) *SubscribePacket {
+	if s.Props == nil || s.Props.SubID == 0 || c.subIDAvail() {
+		return s
+	}
+
+	c.parent.log.d("NET subscription identifier not supported by server", logServer(c.name), logID(s.PacketID))
+	stripped := *s
+	props := *s.Props
+	props.SubID = 0
+	stripped.Props = &props
+	return &stripped
+}
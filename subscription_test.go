@@ -0,0 +1,208 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsyncClient_Resubscribe(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	var present int32
+	b.connAck = func() *ConnAckPacket {
+		return &ConnAckPacket{Present: atomic.LoadInt32(&present) == 1}
+	}
+
+	c, err := NewClient(
+		WithServer(b.addr()),
+		WithAutoReconnect(true),
+		WithBackoffStrategy(10*time.Millisecond, 10*time.Millisecond, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Destroy(true)
+		c.Wait()
+	}()
+
+	subscribed := make(chan []*Topic, 1)
+	c.HandleSub(func(topics []*Topic, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		subscribed <- topics
+	})
+	unSubscribed := make(chan struct{}, 1)
+	c.HandleUnSub(func(topics []string, err error) {
+		unSubscribed <- struct{}{}
+	})
+	waitSub := func() []*Topic {
+		select {
+		case topics := <-subscribed:
+			return topics
+		case <-time.After(5 * time.Second):
+			t.Fatal("subscribe timeout")
+			return nil
+		}
+	}
+
+	connectTestClient(t, c)
+	c.Subscribe(&Topic{Name: "foo", Qos: Qos1}, &Topic{Name: "bar", Qos: Qos2})
+	b.waitPacket(t, CtrlSubscribe)
+	waitSub()
+
+	c.UnSubscribe("bar")
+	b.waitPacket(t, CtrlUnSub)
+	select {
+	case <-unSubscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("unsubscribe timeout")
+	}
+
+	// new session, subscriptions should be restored
+	b.disconnect()
+	s := b.waitPacket(t, CtrlSubscribe).(*SubscribePacket)
+	if len(s.Topics) != 1 || s.Topics[0].Name != "foo" || s.Topics[0].Qos != Qos1 {
+		t.Errorf("unexpected resubscribe topics %v", s.Topics)
+	}
+	if topics := waitSub(); len(topics) != 1 || topics[0].Name != "foo" {
+		t.Errorf("unexpected subscribed topics %v", topics)
+	}
+
+	// session present, no resubscribe
+	atomic.StoreInt32(&present, 1)
+	b.disconnect()
+	b.waitPacket(t, CtrlConn)
+	select {
+	case pkt := <-b.recvC:
+		if pkt.Type() == CtrlSubscribe {
+			t.Error("resubscribed with session present")
+		}
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestAsyncClient_SubscribeWithHandler(t *testing.T) {
+	for _, avail := range []bool{true, false} {
+		b := newTestBroker(t, V5)
+		b.connAck = func() *ConnAckPacket {
+			return &ConnAckPacket{Props: &ConnAckProps{
+				WildcardSubAvail: true,
+				SubIDAvail:       avail,
+				SharedSubAvail:   true,
+			}}
+		}
+
+		c, err := NewClient(WithServer(b.addr()), WithVersion(V5, false), WithRouter(NewSubIDRouter(nil)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		received := make(chan string, 1)
+		connectTestClient(t, c)
+		c.SubscribeWithHandler(func(topic string, qos QosLevel, msg []byte) {
+			received <- topic
+		}, &Topic{Name: "foo", Qos: Qos1})
+
+		s := b.waitPacket(t, CtrlSubscribe).(*SubscribePacket)
+		if subID := s.Props.SubID; (subID != 0) != avail {
+			t.Errorf("subscription identifier = %d with SubIDAvail = %v", subID, avail)
+		}
+
+		// the test broker does not report subscription identifiers,
+		// handler is registered by topic as well
+		c.Publish(&PublishPacket{TopicName: "foo", Payload: []byte("bar")})
+		select {
+		case topic := <-received:
+			if topic != "foo" {
+				t.Errorf("received topic = %q", topic)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("receive timeout")
+		}
+
+		c.Destroy(true)
+		c.Wait()
+		b.close()
+	}
+}
+
+func TestAsyncClient_SubscribeShared(t *testing.T) {
+	b := newTestBroker(t, V5)
+	defer b.close()
+
+	b.connAck = func() *ConnAckPacket {
+		return &ConnAckPacket{Props: &ConnAckProps{WildcardSubAvail: true, SubIDAvail: true}}
+	}
+
+	c, err := NewClient(WithServer(b.addr()), WithVersion(V5, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Destroy(true)
+		c.Wait()
+	}()
+
+	subErr := make(chan error, 1)
+	c.HandleSub(func(topics []*Topic, err error) {
+		subErr <- err
+	})
+	waitSubErr := func() error {
+		select {
+		case err := <-subErr:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("subscribe timeout")
+			return nil
+		}
+	}
+
+	connectTestClient(t, c)
+	c.SubscribeShared("a/b", &Topic{Name: "foo"})
+	if err := waitSubErr(); err != ErrInvalidShareGroup {
+		t.Errorf("subscribe with invalid group error = %v", err)
+	}
+
+	c.SubscribeShared("workers", &Topic{Name: "foo", NoLocal: true})
+	if err := waitSubErr(); err != ErrSharedSubNotAvail {
+		t.Errorf("subscribe without server support error = %v", err)
+	}
+
+	// plain subscriptions are still sent
+	c.Subscribe(&Topic{Name: "foo"})
+	if s := b.waitPacket(t, CtrlSubscribe).(*SubscribePacket); s.Topics[0].Name != "foo" {
+		t.Errorf("unexpected subscribe topic %q", s.Topics[0].Name)
+	}
+}
+
+func TestSharedTopic(t *testing.T) {
+	name, err := sharedTopic("workers", "sensors/+")
+	if err != nil || name != "$share/workers/sensors/+" {
+		t.Errorf("shared topic = %q, err = %v", name, err)
+	}
+
+	for _, topic := range []string{"$share/workers/sensors/+", "sensors/+"} {
+		if f := sharedFilter(topic); f != "sensors/+" {
+			t.Errorf("filter of %q = %q", topic, f)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libmqtt
+
+import "context"
+
+// TracePropagator carries trace context across MQTT 5 publish packets
+// with their user properties (e.g. W3C `traceparent` and `tracestate`)
+//
+// UserProps implements `Get`, `Set` and `Keys`, which makes it a text map
+// carrier for most tracing libraries, an OpenTelemetry propagator can be
+// adapted by passing the UserProps to its Inject and Extract directly
+type TracePropagator interface {
+	// Inject the trace context in ctx into user properties
+	// of the publish packet to be sent
+	Inject(ctx context.Context, props UserProps)
+
+	// Extract the trace context from user properties of the received
+	// publish packet, returns ctx with the trace context
+	Extract(ctx context.Context, props UserProps) context.Context
+}
+
+// injectTrace returns a copy of the publish packet with trace context
+// in ctx injected, the packet itself is returned if no trace propagator
+func (c *AsyncClient) injectTrace(ctx context.Context, p *PublishPacket) *PublishPacket {
+	if c.tracer == nil {
+		return p
+	}
+
+	props := PublishProps{}
+	if p.Props != nil {
+		props = *p.Props
+	}
+	props.UserProps = props.UserProps.clone()
+	c.tracer.Inject(ctx, props.UserProps)
+
+	result := *p
+	result.Props = &props
+	return &result
+}
+
+// extractTrace creates the context for the received publish packet
+func (c *AsyncClient) extractTrace(p *PublishPacket) context.Context {
+	if c.tracer == nil || p.Props == nil || p.Props.UserProps == nil {
+		return c.ctx
+	}
+
+	return c.tracer.Extract(c.ctx, p.Props.UserProps)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package libmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testTraceKey struct{}
+
+type testPropagator struct{}
+
+func (testPropagator) Inject(ctx context.Context, props UserProps) {
+	if v, ok := ctx.Value(testTraceKey{}).(string); ok {
+		props.Set("trace", v)
+	}
+}
+
+func (testPropagator) Extract(ctx context.Context, props UserProps) context.Context {
+	return context.WithValue(ctx, testTraceKey{}, props.Get("trace"))
+}
+
+func TestAsyncClient_TracePropagation(t *testing.T) {
+	b := newTestBroker(t, V5)
+	defer b.close()
+
+	c, err := NewClient(
+		WithServer(b.addr()),
+		WithVersion(V5, false),
+		WithTracePropagator(testPropagator{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traces := make(chan string, 1)
+	c.HandleContext("foo", func(ctx context.Context, pkt *PublishPacket) {
+		v, _ := ctx.Value(testTraceKey{}).(string)
+		traces <- v
+	})
+
+	connectTestClient(t, c)
+	c.Subscribe(&Topic{Name: "foo"})
+	b.waitPacket(t, CtrlSubscribe)
+
+	ctx := context.WithValue(context.Background(), testTraceKey{}, "trace-1")
+	msg := &PublishPacket{TopicName: "foo", Payload: []byte("bar"), Props: &PublishProps{UserProps: UserProps{"foo": {"bar"}}}}
+	c.PublishContext(ctx, msg)
+
+	pub := b.waitPacket(t, CtrlPublish).(*PublishPacket)
+	if pub.Props == nil || pub.Props.UserProps.Get("trace") != "trace-1" || pub.Props.UserProps.Get("foo") != "bar" {
+		t.Errorf("trace context not injected, props = %+v", pub.Props)
+	}
+
+	if len(msg.Props.UserProps) != 1 {
+		t.Errorf("user properties of published packet changed, props = %+v", msg.Props.UserProps)
+	}
+
+	select {
+	case v := <-traces:
+		if v != "trace-1" {
+			t.Errorf("extracted trace = %q, target = trace-1", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("handler not called")
+	}
+
+	c.Destroy(true)
+	c.Wait()
+}
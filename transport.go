@@ -0,0 +1,117 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedScheme is the error when no transport registered
+	// for the scheme of server address
+	ErrUnsupportedScheme = errors.New("server address scheme not supported ")
+)
+
+// Dialer dials network connections, *net.Dialer is a Dialer
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Transport creates the connection to server with the dialer, address is
+// the server address without scheme, tlsConfig is not nil if the
+// connection MUST be secured with TLS
+type Transport func(ctx context.Context, dialer Dialer, address string, tlsConfig *tls.Config) (net.Conn, error)
+
+var (
+	// defaultTransports are transports for supported schemes
+	defaultTransports = map[string]Transport{
+		"tcp":   TCPTransport,
+		"mqtt":  TCPTransport,
+		"ssl":   TCPTransport,
+		"tls":   TCPTransport,
+		"mqtts": TCPTransport,
+		"unix":  UnixTransport,
+		"ws":    WebSocketTransport,
+		"wss":   WebSocketTransport,
+	}
+
+	// secureSchemes are schemes requiring TLS
+	secureSchemes = map[string]bool{
+		"ssl":   true,
+		"tls":   true,
+		"mqtts": true,
+		"wss":   true,
+	}
+)
+
+// TCPTransport connects to server via TCP, with TLS if tlsConfig not nil
+func TCPTransport(ctx context.Context, dialer Dialer, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	return dialStream(ctx, dialer, "tcp", address, tlsConfig)
+}
+
+// UnixTransport connects to server via unix domain socket, with TLS
+// if tlsConfig not nil, address is the path of socket
+func UnixTransport(ctx context.Context, dialer Dialer, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	return dialStream(ctx, dialer, "unix", address, tlsConfig)
+}
+
+// dialStream dials stream connection and performs TLS handshake if required
+func dialStream(ctx context.Context, dialer Dialer, network, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig == nil {
+		return conn, nil
+	}
+
+	if tlsConfig.ServerName == "" && !tlsConfig.InsecureSkipVerify && network != "unix" {
+		// verify server with host name in address
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(address)
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := honorContext(ctx, nil, tlsConn.Handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// splitServer splits server address into scheme and address,
+// scheme is "tcp" if not present
+func splitServer(server string) (scheme, address string) {
+	if i := strings.Index(server, "://"); i > 0 {
+		return strings.ToLower(server[:i]), server[i+3:]
+	}
+	return "tcp", server
+}
+
+// transport returns the transport for scheme
+func (c *AsyncClient) transport(scheme string) (Transport, bool) {
+	if t, ok := c.options.transports[scheme]; ok {
+		return t, true
+	}
+
+	t, ok := defaultTransports[scheme]
+	return t, ok
+}
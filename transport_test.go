@@ -0,0 +1,111 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSplitServer(t *testing.T) {
+	for _, v := range []struct{ server, scheme, address string }{
+		{"localhost:1883", "tcp", "localhost:1883"},
+		{"tcp://localhost:1883", "tcp", "localhost:1883"},
+		{"SSL://localhost:8883", "ssl", "localhost:8883"},
+		{"unix:///var/run/mqtt.sock", "unix", "/var/run/mqtt.sock"},
+	} {
+		if scheme, address := splitServer(v.server); scheme != v.scheme || address != v.address {
+			t.Errorf("split %q = %q, %q", v.server, scheme, address)
+		}
+	}
+}
+
+// redirectDialer dials the test broker for any address
+type redirectDialer struct {
+	target  string
+	network string
+	address string
+}
+
+func (d *redirectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.network, d.address = network, address
+	return (&net.Dialer{}).DialContext(ctx, "tcp", d.target)
+}
+
+func TestAsyncClient_WithDialer(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	d := &redirectDialer{target: b.addr()}
+	c, err := NewClient(WithServer("unix:///var/run/mqtt.sock"), WithDialer(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connectTestClient(t, c)
+	c.Destroy(true)
+	c.Wait()
+
+	if d.network != "unix" || d.address != "/var/run/mqtt.sock" {
+		t.Errorf("dialed %s %s", d.network, d.address)
+	}
+}
+
+func TestAsyncClient_WithTransport(t *testing.T) {
+	b := newTestBroker(t, V311)
+	defer b.close()
+
+	pipe := func(ctx context.Context, dialer Dialer, address string, tlsConfig *tls.Config) (net.Conn, error) {
+		client, server := net.Pipe()
+		go b.handle(server)
+		return client, nil
+	}
+
+	c, err := NewClient(WithServer("pipe://broker"), WithTransport("pipe", pipe))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connectTestClient(t, c)
+	c.Destroy(true)
+	c.Wait()
+}
+
+func TestAsyncClient_UnsupportedScheme(t *testing.T) {
+	c, err := NewClient(WithServer("foo://broker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connected := make(chan error, 1)
+	c.Connect(func(server string, code byte, err error) {
+		connected <- err
+	})
+
+	select {
+	case err := <-connected:
+		if err != ErrUnsupportedScheme {
+			t.Errorf("connect error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("connect timeout")
+	}
+	c.Destroy(true)
+	c.Wait()
+}
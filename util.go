@@ -23,6 +23,8 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
 )
@@ -145,6 +147,16 @@ func writeVarInt(n int, w BufferedWriter) error {
 	return nil
 }
 
+// varIntLen is the count of bytes of n encoded as variable byte integer
+func varIntLen(n int) int {
+	count := 1
+	for n >= 128 {
+		n /= 128
+		count++
+	}
+	return count
+}
+
 func getStringData(data []byte) (string, []byte, error) {
 	b, next, err := getBinaryData(data)
 	if err == nil {
@@ -295,7 +307,7 @@ func getUserProps(data []byte) UserProps {
 // honorContext performs a potentially long-running task, while respecting ctx.
 // If non-nil, the task will be registered with the given WaitGroup.
 func honorContext(ctx context.Context, wg *sync.WaitGroup, task func() error) error {
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
 	if wg != nil {
 		wg.Add(1)
 	}
@@ -312,3 +324,29 @@ func honorContext(ctx context.Context, wg *sync.WaitGroup, task func() error) er
 		return ctx.Err()
 	}
 }
+
+func copyStrings(values []string) []string {
+	return append([]string(nil), values...)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineID returns the id of current goroutine, parsed from the
+// header of stack trace "goroutine <id> [<status>]:"
+func goroutineID() uint64 {
+	b := make([]byte, 64)
+	b = bytes.TrimPrefix(b[:runtime.Stack(b, false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
@@ -411,3 +411,26 @@ func TestGetRawProps(t *testing.T) {
 		t.Error("propKeySharedSubAvail not decoded")
 	}
 }
+
+func TestVarIntLen(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 16383, 16384, 2097151, 2097152, 268435455} {
+		buf := &bytes.Buffer{}
+		writeVarInt(n, buf)
+		if l := varIntLen(n); l != buf.Len() {
+			t.Errorf("varIntLen(%d) = %d, target = %d", n, l, buf.Len())
+		}
+	}
+}
+
+func TestGoroutineID(t *testing.T) {
+	id := goroutineID()
+	if id == 0 || goroutineID() != id {
+		t.Errorf("invalid goroutine id %d", id)
+	}
+
+	other := make(chan uint64)
+	go func() { other <- goroutineID() }()
+	if o := <-other; o == 0 || o == id {
+		t.Errorf("goroutine id of other goroutine = %d, current = %d", o, id)
+	}
+}
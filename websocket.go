@@ -0,0 +1,88 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/websocket"
+)
+
+// webSocketProtocol is the WebSocket subprotocol of MQTT
+const webSocketProtocol = "mqtt"
+
+// WebSocketTransport connects to server via WebSocket (ws:// and wss://),
+// the address is in form of `host[:port][/path]`
+func WebSocketTransport(ctx context.Context, dialer Dialer, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	return dialWebSocket(ctx, dialer, address, tlsConfig, nil)
+}
+
+// NewWebSocketTransport creates WebSocket transport sending custom HTTP
+// headers (e.g. cookies for authentication) in the opening handshake
+func NewWebSocketTransport(header http.Header) Transport {
+	return func(ctx context.Context, dialer Dialer, address string, tlsConfig *tls.Config) (net.Conn, error) {
+		return dialWebSocket(ctx, dialer, address, tlsConfig, header)
+	}
+}
+
+// dialWebSocket dials the server and performs WebSocket handshake,
+// MQTT packets are sent in binary frames, and frames received are read
+// as a byte stream
+func dialWebSocket(ctx context.Context, dialer Dialer, address string, tlsConfig *tls.Config, header http.Header) (net.Conn, error) {
+	scheme, origin, port := "ws", "http", "80"
+	if tlsConfig != nil {
+		scheme, origin, port = "wss", "https", "443"
+	}
+
+	location, err := url.Parse(scheme + "://" + address)
+	if err != nil {
+		return nil, err
+	}
+
+	host := location.Host
+	if location.Port() == "" {
+		host = net.JoinHostPort(location.Hostname(), port)
+	}
+
+	conn, err := dialStream(ctx, dialer, "tcp", host, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &websocket.Config{
+		Location: location,
+		Origin:   &url.URL{Scheme: origin, Host: location.Host},
+		Protocol: []string{webSocketProtocol},
+		Version:  websocket.ProtocolVersionHybi13,
+		Header:   header.Clone(),
+	}
+
+	var ws *websocket.Conn
+	if err := honorContext(ctx, nil, func() (err error) {
+		ws, err = websocket.NewClient(config, conn)
+		return err
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws.PayloadType = websocket.BinaryFrame
+	return ws, nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright Go-IIoT (https://github.com/goiiot)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package libmqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// newWebSocketTestServer serves the test broker over WebSocket,
+// handshake requests are sent to reqC
+func newWebSocketTestServer(b *testBroker, secure bool, reqC chan *http.Request) *httptest.Server {
+	h := websocket.Server{
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			reqC <- req
+			config.Protocol = []string{webSocketProtocol}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+			b.handle(ws)
+		},
+	}
+
+	if secure {
+		return httptest.NewTLSServer(h)
+	}
+	return httptest.NewServer(h)
+}
+
+func TestAsyncClient_WebSocket(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		b := newTestBroker(t, V311)
+		reqC := make(chan *http.Request, 1)
+		srv := newWebSocketTestServer(b, secure, reqC)
+
+		header := http.Header{}
+		header.Set("Cookie", "token=foo")
+
+		options := []Option{
+			WithServer(strings.Replace(srv.URL, "http", "ws", 1) + "/mqtt"),
+			WithTransport("ws", NewWebSocketTransport(header)),
+			WithTransport("wss", NewWebSocketTransport(header)),
+		}
+		if secure {
+			roots := x509.NewCertPool()
+			roots.AddCert(srv.Certificate())
+			options = append(options, WithCustomTLS(&tls.Config{RootCAs: roots}))
+		}
+
+		c, err := NewClient(options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		connectTestClient(t, c)
+		req := <-reqC
+		if req.URL.Path != "/mqtt" || req.Header.Get("Cookie") != "token=foo" {
+			t.Errorf("unexpected handshake request %s %v", req.URL, req.Header)
+		}
+		if p := req.Header.Get("Sec-WebSocket-Protocol"); p != webSocketProtocol {
+			t.Errorf("websocket subprotocol = %q", p)
+		}
+
+		// packets larger than one read go through frames
+		pub := &PublishPacket{TopicName: "foo", Qos: Qos1, Payload: make([]byte, 64*1024)}
+		c.Publish(pub)
+		if p := b.waitPacket(t, CtrlPublish).(*PublishPacket); len(p.Payload) != len(pub.Payload) {
+			t.Errorf("published payload size = %d", len(p.Payload))
+		}
+
+		c.Destroy(true)
+		c.Wait()
+		srv.Close()
+		b.close()
+	}
+}